@@ -1,32 +1,108 @@
 package venstar
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
 	"go.mrm.dev/venstar/thermostat"
 )
 
+// Known device types.
+const (
+	// TypeThermostat is a thermostat which has not reported whether it is a
+	// residential or commercial model.
+	TypeThermostat = "thermostat"
+	// TypeResidential is a residential thermostat.
+	TypeResidential = thermostat.TypeResidential
+	// TypeCommercial is a commercial thermostat.
+	TypeCommercial = thermostat.TypeCommercial
+)
+
+var (
+	// ErrUnknownType is returned when a device type is not one of the known
+	// device types.
+	ErrUnknownType = errors.New("unknown device type")
+	// ErrNotThermostat is returned when a thermostat client is requested for
+	// a device which is not a thermostat.
+	ErrNotThermostat = errors.New("device is not a thermostat")
+)
+
+var thermostatTypes = map[string]bool{
+	TypeThermostat:  true,
+	TypeResidential: true,
+	TypeCommercial:  true,
+}
+
 // Device encompasses any Venstar device
 type Device struct {
-	Type       string
-	Address    string
+	Type    string
+	Address string
+	// Name is the name the device was configured with, when known.
+	Name string
+	// MAC is the hardware address of the device, when known.
+	MAC string
+	// Model, Firmware and APIVersion are populated by Probe.
+	Model      string
+	Firmware   string
+	APIVersion int
 	thermostat *thermostat.Thermostat
 }
 
+// IsThermostat reports whether the device type is a thermostat.
+func (d *Device) IsThermostat() bool {
+	return thermostatTypes[d.Type]
+}
+
 // Thermostat initializes a Thermostat instance if an instance has not already
-// been created. Otherwise it returns the previous reference.
-func (d *Device) Thermostat() *thermostat.Thermostat {
+// been created. Otherwise it returns the previous reference. The options are
+// only applied when the instance is created. ErrNotThermostat is returned if
+// the device type is not a thermostat.
+func (d *Device) Thermostat(opts ...thermostat.Option) (*thermostat.Thermostat, error) {
+	if !d.IsThermostat() {
+		return nil, fmt.Errorf("%w: type %q", ErrNotThermostat, d.Type)
+	}
+	return d.client(opts), nil
+}
+
+func (d *Device) client(opts []thermostat.Option) *thermostat.Thermostat {
 	if d.thermostat == nil {
-		d.thermostat = thermostat.New(d.Address)
+		d.thermostat = thermostat.New(d.Address, opts...)
 	}
 	return d.thermostat
 }
 
+// Probe requests the api info from the device, updating the Type, Model,
+// Firmware and APIVersion. Probe may be used on a device with an unknown
+// type. The options are only applied if a thermostat instance has not
+// already been created.
+//
+// Devices which do not report a type are assumed to be a TypeThermostat.
+// Any other reported type is kept as is, so a type which is not a known
+// thermostat type results in Thermostat returning ErrNotThermostat.
+func (d *Device) Probe(ctx context.Context, opts ...thermostat.Option) error {
+	info, err := d.client(opts).GetAPIInfoContext(ctx)
+	if err != nil {
+		return fmt.Errorf("probing %s: %w", d.Address, err)
+	}
+	d.Type = info.Type
+	if d.Type == "" {
+		d.Type = TypeThermostat
+	}
+	d.Model = info.Model
+	d.Firmware = info.Firmware
+	d.APIVersion = info.Version
+	return nil
+}
+
 // NewDevice creates a new Device instance with the provided Type and Address
 func NewDevice(typ, address string) (*Device, error) {
 	if typ == "" || address == "" {
 		return nil, errors.New("type or address empty")
 	}
+	if !thermostatTypes[typ] {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, typ)
+	}
 	return &Device{
 		Type:    typ,
 		Address: address,
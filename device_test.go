@@ -1,6 +1,12 @@
 package venstar
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"go.mrm.dev/venstar/thermostat"
@@ -8,22 +14,100 @@ import (
 
 func TestDeviceThermostat(t *testing.T) {
 	t.Run("initiates new thermostat", func(t *testing.T) {
-		device := &Device{Address: "127.0.0.1"}
-		device.Thermostat()
+		device := &Device{Type: TypeThermostat, Address: "127.0.0.1"}
+		_, err := device.Thermostat()
+		if err != nil {
+			t.Fatal("error unexpectedly returned: ", err)
+		}
 		if device.thermostat == nil {
 			t.Error("thermostat reference not updated")
 		}
 	})
 	t.Run("reuses reference", func(t *testing.T) {
-		device := &Device{Address: "127.0.0.1"}
+		device := &Device{Type: TypeResidential, Address: "127.0.0.1"}
 		tstat := thermostat.New("127.0.0.2")
 		device.thermostat = tstat
 
-		rtstat := device.Thermostat()
+		rtstat, err := device.Thermostat()
+		if err != nil {
+			t.Fatal("error unexpectedly returned: ", err)
+		}
 		if rtstat != tstat {
 			t.Error("thermostat reference not reused")
 		}
 	})
+	for _, typ := range []string{"", "sensor"} {
+		t.Run("type '"+typ+"' is not a thermostat", func(t *testing.T) {
+			device := &Device{Type: typ, Address: "127.0.0.1"}
+			tstat, err := device.Thermostat()
+			if !errors.Is(err, ErrNotThermostat) {
+				t.Fatal("error invalid, got:", err, "want:", ErrNotThermostat)
+			}
+			if tstat != nil || device.thermostat != nil {
+				t.Error("thermostat unexpectedly created")
+			}
+		})
+	}
+}
+
+func TestDeviceProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantType      string
+		notThermostat bool
+	}{
+		{"residential", `{"api_ver": 7, "type": "residential", "model": "COLORTOUCH", "firmware": "5.10"}`, TypeResidential, false},
+		{"commercial", `{"api_ver": 5, "type": "commercial", "model": "EXPLORER", "firmware": "4.08"}`, TypeCommercial, false},
+		{"unreported type", `{"api_ver": 4, "model": "COLORTOUCH", "firmware": "3.00"}`, TypeThermostat, false},
+		{"unknown type kept", `{"api_ver": 7, "type": "sensor", "model": "WIFI-SENSOR", "firmware": "1.02"}`, "sensor", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/" {
+					t.Error("path, got:", r.URL.Path, "want: /")
+				}
+				io.WriteString(w, test.body)
+			}))
+			defer server.Close()
+
+			device := &Device{Address: strings.TrimPrefix(server.URL, "http://")}
+			if err := device.Probe(context.Background()); err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			if device.Type != test.wantType {
+				t.Error("device type invalid, got:", device.Type, "want:", test.wantType)
+			}
+			if device.Model == "" || device.Firmware == "" || device.APIVersion == 0 {
+				t.Errorf("device info not populated, got: %+v", device)
+			}
+			_, err := device.Thermostat()
+			if test.notThermostat {
+				if !errors.Is(err, ErrNotThermostat) {
+					t.Error("error invalid, got:", err, "want:", ErrNotThermostat)
+				}
+				return
+			}
+			if err != nil {
+				t.Error("error unexpectedly returned: ", err)
+			}
+		})
+	}
+	t.Run("errors get returned", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		device := &Device{Address: strings.TrimPrefix(server.URL, "http://")}
+		err := device.Probe(context.Background())
+		var apiErr *thermostat.APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatal("error invalid, got:", err, "want: *thermostat.APIError")
+		}
+		if device.Type != "" {
+			t.Error("device type unexpectedly set:", device.Type)
+		}
+	})
 }
 
 func TestNewDevice(t *testing.T) {
@@ -36,7 +120,10 @@ func TestNewDevice(t *testing.T) {
 		{"both empty", "", "", "type or address empty"},
 		{"type empty", "", "filled", "type or address empty"},
 		{"address empty", "filled", "", "type or address empty"},
-		{"valid", "type", "address", ""},
+		{"unknown type", "type", "address", `unknown device type: "type"`},
+		{"valid thermostat", TypeThermostat, "address", ""},
+		{"valid residential", TypeResidential, "address", ""},
+		{"valid commercial", TypeCommercial, "address", ""},
 	}
 
 	for _, test := range tests {
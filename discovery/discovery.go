@@ -0,0 +1,192 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mrm.dev/venstar"
+)
+
+const (
+	// DefaultAddress is the SSDP multicast address searched.
+	DefaultAddress = "239.255.255.250:1900"
+	// DefaultSearchTarget is the search target Venstar thermostats respond to.
+	DefaultSearchTarget = "venstar:thermostat:ecp"
+	// DefaultTimeout is how long responses are collected for when the context
+	// has no deadline.
+	DefaultTimeout = 3 * time.Second
+)
+
+// Discoverer searches the local network for Venstar devices using SSDP.
+type Discoverer struct {
+	// Address is the UDP address the M-SEARCH request is sent to.
+	// Defaults to DefaultAddress.
+	Address string
+	// SearchTarget is the ST header sent. Defaults to DefaultSearchTarget.
+	SearchTarget string
+	// Timeout is how long responses are collected for when the context has
+	// no earlier deadline. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Discover searches the local network for Venstar thermostats using the
+// default Discoverer.
+func Discover(ctx context.Context) ([]*venstar.Device, error) {
+	return (&Discoverer{}).Discover(ctx)
+}
+
+// Discover sends an M-SEARCH request and collects the devices which respond
+// until the timeout or context deadline is reached. Devices are returned in
+// the order they responded, once per MAC address.
+func (d *Discoverer) Discover(ctx context.Context) ([]*venstar.Device, error) {
+	address := d.Address
+	if address == "" {
+		address = DefaultAddress
+	}
+	target := d.SearchTarget
+	if target == "" {
+		target = DefaultSearchTarget
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", address, err)
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listening for responses: %w", err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	if _, err := conn.WriteTo(searchRequest(address, target, deadline), raddr); err != nil {
+		return nil, fmt.Errorf("sending search request: %w", err)
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var devices []*venstar.Device
+	seen := make(map[string]bool)
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return devices, ctx.Err()
+				}
+				return devices, nil
+			}
+			return devices, fmt.Errorf("reading responses: %w", err)
+		}
+		device, err := ParseResponse(buf[:n], target)
+		if err != nil {
+			continue
+		}
+		if device.Address == "" {
+			device.Address = from.(*net.UDPAddr).IP.String()
+		}
+		key := device.MAC
+		if key == "" {
+			key = device.Address
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		devices = append(devices, device)
+	}
+}
+
+// searchRequest builds the M-SEARCH request, asking devices to respond within
+// the time remaining.
+func searchRequest(host, target string, deadline time.Time) []byte {
+	mx := int(time.Until(deadline) / time.Second)
+	mx = max(1, min(mx-1, 5))
+	return []byte("M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + host + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		fmt.Sprintf("MX: %d\r\n", mx) +
+		"ST: " + target + "\r\n" +
+		"\r\n")
+}
+
+// ParseResponse parses an SSDP search response into a Device. Responses for
+// a search target other than target are rejected.
+//
+// Venstar devices identify themselves with a USN in the form of
+// `ecp:<mac>:name:<url encoded name>:type:<type>`.
+func ParseResponse(data []byte, target string) (*venstar.Device, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	if st := resp.Header.Get("ST"); st != target {
+		return nil, fmt.Errorf("unexpected search target %q", st)
+	}
+
+	device := &venstar.Device{}
+	if location := resp.Header.Get("Location"); location != "" {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("parsing location: %w", err)
+		}
+		device.Address = u.Host
+	}
+
+	usn := resp.Header.Get("USN")
+	if !strings.HasPrefix(usn, "ecp:") {
+		return nil, fmt.Errorf("unexpected usn %q", usn)
+	}
+	parts := strings.Split(strings.TrimPrefix(usn, "ecp:"), ":")
+	if len(parts) < 6 {
+		return nil, fmt.Errorf("usn missing mac address %q", usn)
+	}
+	mac, err := net.ParseMAC(strings.Join(parts[:6], ":"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing usn mac address: %w", err)
+	}
+	device.MAC = mac.String()
+	for i := 6; i+1 < len(parts); i += 2 {
+		value, err := url.PathUnescape(parts[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("parsing usn %s: %w", parts[i], err)
+		}
+		switch parts[i] {
+		case "name":
+			device.Name = value
+		case "type":
+			device.Type = value
+		}
+	}
+	if device.Type == "" {
+		device.Type = venstar.TypeThermostat
+	}
+	return device, nil
+}
@@ -0,0 +1,183 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mrm.dev/venstar"
+)
+
+// fakeResponder is a stand-in for thermostats answering SSDP searches.
+type fakeResponder struct {
+	conn      *net.UDPConn
+	responses []string
+	requests  chan *http.Request
+}
+
+func newFakeResponder(t *testing.T, responses ...string) *fakeResponder {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("listening:", err)
+	}
+	r := &fakeResponder{
+		conn:      conn,
+		responses: responses,
+		requests:  make(chan *http.Request, 10),
+	}
+	t.Cleanup(func() { conn.Close() })
+	go r.serve()
+	return r
+}
+
+func (r *fakeResponder) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil {
+			continue
+		}
+		r.requests <- req
+		for _, resp := range r.responses {
+			r.conn.WriteTo([]byte(resp), from)
+		}
+	}
+}
+
+func (r *fakeResponder) address() string {
+	return r.conn.LocalAddr().String()
+}
+
+func ssdpResponse(st, location, usn string) string {
+	return "HTTP/1.1 200 OK\r\n" +
+		"Cache-Control: max-age=300\r\n" +
+		"ST: " + st + "\r\n" +
+		"Location: " + location + "\r\n" +
+		"USN: " + usn + "\r\n" +
+		"\r\n"
+}
+
+func TestDiscover(t *testing.T) {
+	responder := newFakeResponder(t,
+		ssdpResponse(DefaultSearchTarget, "http://192.168.1.100/", "ecp:00:23:a7:3a:b2:72:name:Living%20Room:type:residential"),
+		ssdpResponse("upnp:rootdevice", "http://192.168.1.5/", "uuid:other"),
+		ssdpResponse(DefaultSearchTarget, "http://192.168.1.100/", "ecp:00:23:a7:3a:b2:72:name:Living%20Room:type:residential"),
+		ssdpResponse(DefaultSearchTarget, "http://192.168.1.101/", "ecp:00:23:a7:3a:b2:73:name:Office:type:commercial"),
+		"garbage",
+	)
+	d := &Discoverer{
+		Address: responder.address(),
+		Timeout: 200 * time.Millisecond,
+	}
+	devices, err := d.Discover(context.Background())
+	if err != nil {
+		t.Fatal("error unexpected, got:", err)
+	}
+
+	select {
+	case req := <-responder.requests:
+		if req.Method != "M-SEARCH" {
+			t.Error("method, got:", req.Method, "want: M-SEARCH")
+		}
+		if got := req.Header.Get("ST"); got != DefaultSearchTarget {
+			t.Error("ST, got:", got, "want:", DefaultSearchTarget)
+		}
+		if got := req.Header.Get("MAN"); got != `"ssdp:discover"` {
+			t.Error("MAN, got:", got)
+		}
+	default:
+		t.Error("no search request received")
+	}
+
+	if len(devices) != 2 {
+		t.Fatal("devices, got:", len(devices), "want: 2")
+	}
+	want := []struct{ address, mac, name, typ string }{
+		{"192.168.1.100", "00:23:a7:3a:b2:72", "Living Room", "residential"},
+		{"192.168.1.101", "00:23:a7:3a:b2:73", "Office", "commercial"},
+	}
+	for i, w := range want {
+		device := devices[i]
+		if device.Address != w.address || device.MAC != w.mac || device.Name != w.name || device.Type != w.typ {
+			t.Errorf("device %d, got: %+v want: %+v", i, device, w)
+		}
+	}
+}
+
+func TestDiscoverContext(t *testing.T) {
+	responder := newFakeResponder(t)
+	d := &Discoverer{
+		Address: responder.address(),
+		Timeout: time.Minute,
+	}
+	t.Run("deadline ends search", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		devices, err := d.Discover(ctx)
+		if err != nil {
+			t.Fatal("error unexpected, got:", err)
+		}
+		if len(devices) != 0 {
+			t.Error("devices, got:", len(devices), "want: 0")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Error("deadline not respected, took:", elapsed)
+		}
+	})
+	t.Run("cancel returns error", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err := d.Discover(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Error("error invalid, got:", err, "want:", context.Canceled)
+		}
+	})
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    [4]string
+		wantErr bool
+	}{
+		{"valid", ssdpResponse(DefaultSearchTarget, "http://10.0.0.2/", "ecp:00:23:A7:3A:B2:72:name:Thermostat:type:residential"), [4]string{"10.0.0.2", "00:23:a7:3a:b2:72", "Thermostat", "residential"}, false},
+		{"location port", ssdpResponse(DefaultSearchTarget, "http://10.0.0.2:8080/", "ecp:00:23:a7:3a:b2:72"), [4]string{"10.0.0.2:8080", "00:23:a7:3a:b2:72", "", venstar.TypeThermostat}, false},
+		{"escaped name", ssdpResponse(DefaultSearchTarget, "http://10.0.0.2/", "ecp:00:23:a7:3a:b2:72:name:Up%3Astairs:type:commercial"), [4]string{"10.0.0.2", "00:23:a7:3a:b2:72", "Up:stairs", "commercial"}, false},
+		{"wrong target", ssdpResponse("upnp:rootdevice", "http://10.0.0.2/", "ecp:00:23:a7:3a:b2:72"), [4]string{}, true},
+		{"bad usn", ssdpResponse(DefaultSearchTarget, "http://10.0.0.2/", "uuid:1234"), [4]string{}, true},
+		{"short mac", ssdpResponse(DefaultSearchTarget, "http://10.0.0.2/", "ecp:00:23:a7"), [4]string{}, true},
+		{"invalid mac", ssdpResponse(DefaultSearchTarget, "http://10.0.0.2/", "ecp:zz:23:a7:3a:b2:72"), [4]string{}, true},
+		{"bad status", "HTTP/1.1 404 Not Found\r\n\r\n", [4]string{}, true},
+		{"garbage", "garbage", [4]string{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			device, err := ParseResponse([]byte(test.data), DefaultSearchTarget)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("error expected but no error returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("error unexpected, got:", err)
+			}
+			got := [4]string{device.Address, device.MAC, device.Name, device.Type}
+			if got != test.want {
+				t.Error("device, got:", got, "want:", test.want)
+			}
+		})
+	}
+}
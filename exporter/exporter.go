@@ -0,0 +1,260 @@
+// Package exporter serves Venstar thermostat readings as Prometheus metrics.
+//
+// Each scrape of the Exporter queries every target concurrently, labeling
+// the metrics of each thermostat with the target name. Temperatures are
+// converted to celsius, enum values such as the mode are exposed as state
+// sets, and the daily runtimes reported by the thermostat are accumulated
+// into counters.
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+// DefaultTimeout is how long each target is scraped for when no timeout is
+// set.
+const DefaultTimeout = 10 * time.Second
+
+// Target is a thermostat scraped by an Exporter.
+type Target struct {
+	// Name is the value of the target label on each metric, such as the
+	// inventory alias or address of the thermostat.
+	Name       string
+	Thermostat *thermostat.Thermostat
+}
+
+// Exporter scrapes thermostats, serving their readings in the Prometheus text
+// exposition format.
+type Exporter struct {
+	Targets []*Target
+	// Timeout limits how long each target is scraped for. Defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	runtimes map[string]*runtimeTotals
+}
+
+// New creates an Exporter for the targets.
+func New(targets ...*Target) *Exporter {
+	return &Exporter{Targets: targets}
+}
+
+// ServeHTTP scrapes the targets and writes the metrics.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := e.WriteMetrics(r.Context(), &buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(buf.Bytes())
+}
+
+// WriteMetrics scrapes the targets and writes the metrics to w. Targets which
+// fail to be scraped are reported through the venstar_up and
+// venstar_scrape_error metrics rather than an error.
+func (e *Exporter) WriteMetrics(ctx context.Context, w io.Writer) error {
+	m := e.collect(ctx)
+	if _, err := m.WriteTo(w); err != nil {
+		return fmt.Errorf("writing metrics: %w", err)
+	}
+	return nil
+}
+
+type scrape struct {
+	snap     *thermostat.Snapshot
+	duration time.Duration
+}
+
+func (e *Exporter) collect(ctx context.Context) *metricSet {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	scrapes := make([]scrape, len(e.Targets))
+	var wg sync.WaitGroup
+	for i, target := range e.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			snap, _ := target.Thermostat.Snapshot(ctx)
+			scrapes[i] = scrape{snap: snap, duration: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+
+	m := newMetricSet()
+	for i, target := range e.Targets {
+		e.collectTarget(m, target.Name, scrapes[i])
+	}
+	return m
+}
+
+// sections are the snapshot sections reported by venstar_scrape_error.
+var sections = []thermostat.Section{
+	thermostat.SectionAPIInfo,
+	thermostat.SectionQueryInfo,
+	thermostat.SectionSensors,
+	thermostat.SectionRuntimes,
+	thermostat.SectionAlerts,
+}
+
+func (e *Exporter) collectTarget(m *metricSet, target string, s scrape) {
+	snap := s.snap
+	m.addBool(descUp, snap.QueryInfo != nil, "target", target)
+	m.add(descScrapeDuration, s.duration.Seconds(), "target", target)
+	for _, section := range sections {
+		m.addBool(descScrapeError, snap.Errors[section] != nil, "target", target, "section", string(section))
+	}
+
+	if api := snap.APIInfo; api != nil {
+		m.add(descInfo, 1, "target", target,
+			"model", api.Model,
+			"firmware", api.Firmware,
+			"type", api.Type,
+			"api_version", strconv.Itoa(api.Version))
+	}
+
+	if info := snap.QueryInfo; info != nil {
+		m.add(descSpaceTemp, info.SpaceTemperature().Celsius(), "target", target)
+		m.add(descHeatSetPoint, info.HeatTemperature().Celsius(), "target", target)
+		m.add(descCoolSetPoint, info.CoolTemperature().Celsius(), "target", target)
+		if info.HumidityEnabled == 1 {
+			m.add(descHumidity, float64(info.Humidity), "target", target)
+			m.add(descHumidifySetPoint, float64(info.HumidifySetPoint), "target", target)
+			m.add(descDehumidifySetPoint, float64(info.DehumidifySetPoint), "target", target)
+		}
+		addStateSet(m, descMode, target, "mode", info.Mode, modes)
+		addStateSet(m, descState, target, "state", info.State, states)
+		addStateSet(m, descFanState, target, "fan_state", info.FanState, fanStates)
+		addStateSet(m, descAway, target, "away", info.Away, aways)
+		addStateSet(m, descSchedulePart, target, "schedule_part", info.SchedulePart, scheduleParts)
+	}
+
+	for _, sensor := range snap.Sensors {
+		// Sensor units are only known alongside the query info.
+		if temp, ok := sensor.Temperature(); ok {
+			m.add(descSensorTemp, temp.Celsius(), "target", target, "sensor", sensor.Name)
+		}
+	}
+
+	for _, alert := range snap.Alerts {
+		m.addBool(descAlertActive, alert.Active, "target", target, "alert", alert.Name)
+	}
+
+	e.collectRuntimes(m, target, snap.Runtimes)
+}
+
+var (
+	modes         = []fmt.Stringer{thermostat.ModeOff, thermostat.ModeHeat, thermostat.ModeCool, thermostat.ModeAuto}
+	states        = []fmt.Stringer{thermostat.State(0), thermostat.State(1), thermostat.State(2), thermostat.State(3), thermostat.State(4)}
+	fanStates     = []fmt.Stringer{thermostat.FanState(0), thermostat.FanState(1)}
+	aways         = []fmt.Stringer{thermostat.Away(0), thermostat.Away(1)}
+	scheduleParts = []fmt.Stringer{thermostat.SchedulePart(0), thermostat.SchedulePart(1), thermostat.SchedulePart(2), thermostat.SchedulePart(3), thermostat.SchedulePart(255)}
+)
+
+// addStateSet records a sample for each known value, set to 1 for the
+// current value and 0 otherwise.
+func addStateSet(m *metricSet, d *desc, target, label string, current fmt.Stringer, values []fmt.Stringer) {
+	for _, value := range values {
+		m.addBool(d, value == current, "target", target, label, value.String())
+	}
+}
+
+func (e *Exporter) collectRuntimes(m *metricSet, target string, runtimes []*thermostat.Runtime) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.runtimes == nil {
+		e.runtimes = make(map[string]*runtimeTotals)
+	}
+	totals := e.runtimes[target]
+	if totals == nil {
+		totals = &runtimeTotals{}
+		e.runtimes[target] = totals
+	}
+	if runtimes != nil {
+		totals.update(runtimes)
+	}
+	for _, key := range totals.keys() {
+		m.add(descRuntime, totals.totals[key].Seconds(), "target", target, "equipment", key.equipment, "stage", key.stage)
+	}
+}
+
+type runtimeKey struct {
+	equipment string
+	stage     string
+}
+
+// runtimeTotals accumulates the daily runtimes reported by a thermostat.
+//
+// Thermostats report the runtime of each of the last several days, each
+// covering the period since the previous timestamp, followed by the current
+// day so far, timestamped with the current time. Days are tracked by the
+// start of their period so only the increase of each day since the previous
+// scrape is added, and the totals never decrease as days stop being reported.
+type runtimeTotals struct {
+	days   map[int64]*thermostat.Runtime
+	totals map[runtimeKey]time.Duration
+}
+
+func (r *runtimeTotals) update(runtimes []*thermostat.Runtime) {
+	if r.totals == nil {
+		r.totals = make(map[runtimeKey]time.Duration)
+	}
+	runtimes = append([]*thermostat.Runtime(nil), runtimes...)
+	sort.Slice(runtimes, func(i, j int) bool {
+		return runtimes[i].Timestamp.Before(runtimes[j].Timestamp)
+	})
+	days := make(map[int64]*thermostat.Runtime, len(runtimes))
+	for i, runtime := range runtimes {
+		start := runtime.Timestamp.Add(-24 * time.Hour).Unix()
+		if i > 0 {
+			start = runtimes[i-1].Timestamp.Unix()
+		}
+		prev := r.days[start]
+		if prev == nil {
+			prev = &thermostat.Runtime{}
+		}
+		r.add("heat", runtime.Heaters, prev.Heaters)
+		r.add("cool", runtime.Coolers, prev.Coolers)
+		r.add("aux", runtime.Aux, prev.Aux)
+		days[start] = runtime
+	}
+	r.days = days
+}
+
+func (r *runtimeTotals) add(equipment string, cur, prev map[string]time.Duration) {
+	for stage, d := range cur {
+		key := runtimeKey{equipment: equipment, stage: stage}
+		r.totals[key] += max(d-prev[stage], 0)
+	}
+}
+
+// keys returns the equipment stages in a stable order.
+func (r *runtimeTotals) keys() []runtimeKey {
+	keys := make([]runtimeKey, 0, len(r.totals))
+	for key := range r.totals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].equipment != keys[j].equipment {
+			return keys[i].equipment < keys[j].equipment
+		}
+		return keys[i].stage < keys[j].stage
+	})
+	return keys
+}
@@ -0,0 +1,160 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mrm.dev/venstar/thermostat"
+	"go.mrm.dev/venstar/thermostat/thermostattest"
+)
+
+// fakeInfo is the query info served by the stand-in thermostats.
+var fakeInfo = thermostat.QueryInfo{
+	Name:               "Hallway",
+	Mode:               thermostat.ModeHeat,
+	State:              1,
+	FanState:           1,
+	Schedule:           1,
+	SchedulePart:       2,
+	SpaceTemp:          68,
+	HeatTemp:           68,
+	CoolTemp:           77,
+	HumidityEnabled:    1,
+	Humidity:           41,
+	HumidifySetPoint:   35,
+	DehumidifySetPoint: 60,
+}
+
+func newTarget(t *testing.T, name string) (*thermostattest.Server, *Target) {
+	t.Helper()
+	fake := thermostattest.NewServer(t, fakeInfo)
+	return fake, &Target{Name: name, Thermostat: fake.Thermostat()}
+}
+
+func scrapeLines(t *testing.T, e *Exporter) map[string]bool {
+	t.Helper()
+	var buf strings.Builder
+	if err := e.WriteMetrics(context.Background(), &buf); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "venstar_scrape_duration_seconds") {
+			continue
+		}
+		lines[line] = true
+	}
+	return lines
+}
+
+func TestExporterMetrics(t *testing.T) {
+	_, target := newTarget(t, "hallway")
+	e := New(target)
+	lines := scrapeLines(t, e)
+	want := []string{
+		"# HELP venstar_up Whether the thermostat query info was retrieved.",
+		"# TYPE venstar_up gauge",
+		`venstar_up{target="hallway"} 1`,
+		`venstar_scrape_error{target="hallway",section="query info"} 0`,
+		`venstar_info{target="hallway",model="COLORTOUCH",firmware="5.10",type="residential",api_version="7"} 1`,
+		`venstar_space_temperature_celsius{target="hallway"} 20`,
+		`venstar_heat_setpoint_celsius{target="hallway"} 20`,
+		`venstar_cool_setpoint_celsius{target="hallway"} 25`,
+		`venstar_humidity_percent{target="hallway"} 41`,
+		`venstar_humidify_setpoint_percent{target="hallway"} 35`,
+		`venstar_dehumidify_setpoint_percent{target="hallway"} 60`,
+		`venstar_mode{target="hallway",mode="off"} 0`,
+		`venstar_mode{target="hallway",mode="heat"} 1`,
+		`venstar_state{target="hallway",state="heating"} 1`,
+		`venstar_state{target="hallway",state="idle"} 0`,
+		`venstar_fan_state{target="hallway",fan_state="on"} 1`,
+		`venstar_away{target="hallway",away="home"} 1`,
+		`venstar_schedule_part{target="hallway",schedule_part="evening"} 1`,
+		`venstar_schedule_part{target="hallway",schedule_part="inactive"} 0`,
+		`venstar_sensor_temperature_celsius{target="hallway",sensor="Outdoor"} 0`,
+		`venstar_alert_active{target="hallway",alert="Air Filter"} 1`,
+		`venstar_alert_active{target="hallway",alert="Service"} 0`,
+		"# TYPE venstar_runtime_seconds_total counter",
+		`venstar_runtime_seconds_total{target="hallway",equipment="heat",stage="1"} 1800`,
+		`venstar_runtime_seconds_total{target="hallway",equipment="heat",stage="2"} 300`,
+		`venstar_runtime_seconds_total{target="hallway",equipment="cool",stage="1"} 0`,
+	}
+	for _, line := range want {
+		if !lines[line] {
+			t.Error("metric missing:", line)
+		}
+	}
+}
+
+func TestExporterScrapeErrors(t *testing.T) {
+	_, target := newTarget(t, "hallway")
+	down := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(down.Close)
+	e := New(target, &Target{
+		Name:       "basement",
+		Thermostat: thermostat.New(strings.TrimPrefix(down.URL, "http://")),
+	})
+	lines := scrapeLines(t, e)
+	want := []string{
+		`venstar_up{target="hallway"} 1`,
+		`venstar_up{target="basement"} 0`,
+		`venstar_scrape_error{target="basement",section="api info"} 1`,
+		`venstar_scrape_error{target="basement",section="query alerts"} 1`,
+		`venstar_scrape_error{target="hallway",section="api info"} 0`,
+	}
+	for _, line := range want {
+		if !lines[line] {
+			t.Error("metric missing:", line)
+		}
+	}
+	for line := range lines {
+		if strings.Contains(line, `target="basement"`) && !strings.HasPrefix(line, "venstar_up") && !strings.HasPrefix(line, "venstar_scrape_error") {
+			t.Error("unexpected metric for failed target:", line)
+		}
+	}
+}
+
+func TestExporterRuntimeCounters(t *testing.T) {
+	fake, target := newTarget(t, "hallway")
+	e := New(target)
+	tests := []struct {
+		name     string
+		runtimes string
+		want     int
+	}{
+		{"initial days counted", `{"runtimes": [{"ts": 1700006400, "heat1": 30}, {"ts": 1700042400, "heat1": 10}]}`, 2400},
+		{"current day increase added", `{"runtimes": [{"ts": 1700006400, "heat1": 30}, {"ts": 1700049600, "heat1": 25}]}`, 3300},
+		{"completed day", `{"runtimes": [{"ts": 1700006400, "heat1": 30}, {"ts": 1700092800, "heat1": 30}, {"ts": 1700096400, "heat1": 5}]}`, 3900},
+		{"dropped day kept", `{"runtimes": [{"ts": 1700092800, "heat1": 30}, {"ts": 1700100000, "heat1": 10}]}`, 4200},
+		{"failed scrape kept", `{"runtimes": "bad"}`, 4200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake.SetBody("/query/runtimes", test.runtimes)
+			lines := scrapeLines(t, e)
+			want := fmt.Sprintf(`venstar_runtime_seconds_total{target="hallway",equipment="heat",stage="1"} %d`, test.want)
+			if !lines[want] {
+				t.Error("metric missing:", want)
+			}
+		})
+	}
+}
+
+func TestExporterServeHTTP(t *testing.T) {
+	_, target := newTarget(t, "hallway")
+	rec := httptest.NewRecorder()
+	New(target).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Error("status invalid, got:", rec.Code, "want:", http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Error("Content-Type invalid, got:", got, "want:", ContentType)
+	}
+	if !strings.Contains(rec.Body.String(), `venstar_up{target="hallway"} 1`) {
+		t.Error("body invalid, got:", rec.Body.String())
+	}
+}
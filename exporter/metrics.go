@@ -0,0 +1,139 @@
+package exporter
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+// written by Exporter.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// desc describes a metric family.
+type desc struct {
+	name string
+	help string
+	typ  string
+}
+
+var (
+	descUp                 = &desc{"venstar_up", "Whether the thermostat query info was retrieved.", "gauge"}
+	descScrapeDuration     = &desc{"venstar_scrape_duration_seconds", "Time taken to scrape the thermostat.", "gauge"}
+	descScrapeError        = &desc{"venstar_scrape_error", "Whether retrieving the section from the thermostat failed.", "gauge"}
+	descInfo               = &desc{"venstar_info", "Thermostat model information.", "gauge"}
+	descSpaceTemp          = &desc{"venstar_space_temperature_celsius", "Current space temperature.", "gauge"}
+	descHeatSetPoint       = &desc{"venstar_heat_setpoint_celsius", "Current heat set point.", "gauge"}
+	descCoolSetPoint       = &desc{"venstar_cool_setpoint_celsius", "Current cool set point.", "gauge"}
+	descHumidity           = &desc{"venstar_humidity_percent", "Current relative humidity.", "gauge"}
+	descHumidifySetPoint   = &desc{"venstar_humidify_setpoint_percent", "Current humidify set point.", "gauge"}
+	descDehumidifySetPoint = &desc{"venstar_dehumidify_setpoint_percent", "Current dehumidify set point.", "gauge"}
+	descMode               = &desc{"venstar_mode", "Current thermostat mode.", "gauge"}
+	descState              = &desc{"venstar_state", "Current thermostat state.", "gauge"}
+	descFanState           = &desc{"venstar_fan_state", "Current fan state.", "gauge"}
+	descAway               = &desc{"venstar_away", "Current away setting.", "gauge"}
+	descSchedulePart       = &desc{"venstar_schedule_part", "Current schedule part.", "gauge"}
+	descSensorTemp         = &desc{"venstar_sensor_temperature_celsius", "Current sensor temperature.", "gauge"}
+	descAlertActive        = &desc{"venstar_alert_active", "Whether the alert is active.", "gauge"}
+	descRuntime            = &desc{"venstar_runtime_seconds_total", "Time the equipment stage has been running.", "counter"}
+)
+
+// descs are the metric families in the order they are written.
+var descs = []*desc{
+	descUp,
+	descScrapeDuration,
+	descScrapeError,
+	descInfo,
+	descSpaceTemp,
+	descHeatSetPoint,
+	descCoolSetPoint,
+	descHumidity,
+	descHumidifySetPoint,
+	descDehumidifySetPoint,
+	descMode,
+	descState,
+	descFanState,
+	descAway,
+	descSchedulePart,
+	descSensorTemp,
+	descAlertActive,
+	descRuntime,
+}
+
+type sample struct {
+	// labels are label name and value pairs.
+	labels []string
+	value  float64
+}
+
+// metricSet collects samples grouped by metric family.
+type metricSet struct {
+	samples map[*desc][]sample
+}
+
+func newMetricSet() *metricSet {
+	return &metricSet{samples: make(map[*desc][]sample)}
+}
+
+// add records a sample for the metric family. Labels are provided as name and
+// value pairs.
+func (m *metricSet) add(d *desc, value float64, labels ...string) {
+	m.samples[d] = append(m.samples[d], sample{labels: labels, value: value})
+}
+
+// addBool records 1 for true and 0 for false.
+func (m *metricSet) addBool(d *desc, value bool, labels ...string) {
+	var v float64
+	if value {
+		v = 1
+	}
+	m.add(d, v, labels...)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// WriteTo writes the metric families with samples in the text exposition
+// format.
+func (m *metricSet) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, d := range descs {
+		samples := m.samples[d]
+		if len(samples) == 0 {
+			continue
+		}
+		bw.WriteString("# HELP " + d.name + " " + helpEscaper.Replace(d.help) + "\n")
+		bw.WriteString("# TYPE " + d.name + " " + d.typ + "\n")
+		for _, s := range samples {
+			bw.WriteString(d.name)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(s.labels[i] + `="` + labelEscaper.Replace(s.labels[i+1]) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + strconv.FormatFloat(s.value, 'g', -1, 64) + "\n")
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,38 @@
+package exporter
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMetricSetWriteTo(t *testing.T) {
+	m := newMetricSet()
+	m.add(descAlertActive, 1, "target", "hall", "alert", `Filter "A"\B`)
+	m.add(descSensorTemp, 21.5, "target", "hall", "sensor", "line\nbreak")
+	m.add(descUp, math.NaN())
+	m.addBool(descUp, false, "target", "hall")
+
+	var buf strings.Builder
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	want := `# HELP venstar_up Whether the thermostat query info was retrieved.
+# TYPE venstar_up gauge
+venstar_up NaN
+venstar_up{target="hall"} 0
+# HELP venstar_sensor_temperature_celsius Current sensor temperature.
+# TYPE venstar_sensor_temperature_celsius gauge
+venstar_sensor_temperature_celsius{target="hall",sensor="line\nbreak"} 21.5
+# HELP venstar_alert_active Whether the alert is active.
+# TYPE venstar_alert_active gauge
+venstar_alert_active{target="hall",alert="Filter \"A\"\\B"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("output invalid, got:\n%s\nwant:\n%s", got, want)
+	}
+	if n != int64(len(want)) {
+		t.Error("written invalid, got:", n, "want:", len(want))
+	}
+}
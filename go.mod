@@ -1,5 +1,3 @@
 module go.mrm.dev/venstar
 
 go 1.23
-
-require github.com/pkg/errors v0.9.1
@@ -0,0 +1,295 @@
+package venstar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+// InventoryEntry is a named device within an Inventory.
+type InventoryEntry struct {
+	// Alias uniquely identifies the device within the inventory.
+	Alias   string `json:"alias"`
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Name    string `json:"name,omitempty"`
+	MAC     string `json:"mac,omitempty"`
+	Pin     string `json:"pin,omitempty"`
+	// Credentials references the credentials used to authenticate with the
+	// device, such as the name of a secret. The reference is resolved by the
+	// CredentialsResolver provided to ThermostatOptions.
+	Credentials string   `json:"credentials,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// HasTag reports whether the entry is tagged with tag.
+func (e *InventoryEntry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Device creates a new Device for the entry.
+func (e *InventoryEntry) Device() (*Device, error) {
+	device, err := NewDevice(e.Type, e.Address)
+	if err != nil {
+		return nil, fmt.Errorf("device %s: %w", e.Alias, err)
+	}
+	device.Name = e.Name
+	device.MAC = e.MAC
+	return device, nil
+}
+
+// CredentialsResolver resolves the Credentials reference of an
+// InventoryEntry into the username and password used to authenticate with the
+// device.
+type CredentialsResolver func(ref string) (username, password string, err error)
+
+// EnvCredentials is a CredentialsResolver reading the credentials from the
+// environment. The reference is upper cased, with any character other than a
+// letter or digit replaced by an underscore, and used as the prefix of the
+// _USERNAME and _PASSWORD variables. The reference `office-secret` reads
+// $OFFICE_SECRET_USERNAME and $OFFICE_SECRET_PASSWORD.
+func EnvCredentials(ref string) (string, string, error) {
+	prefix := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, ref)
+	username, ok := os.LookupEnv(prefix + "_USERNAME")
+	if !ok {
+		return "", "", fmt.Errorf("credentials %q: $%s_USERNAME not set", ref, prefix)
+	}
+	password, ok := os.LookupEnv(prefix + "_PASSWORD")
+	if !ok {
+		return "", "", fmt.Errorf("credentials %q: $%s_PASSWORD not set", ref, prefix)
+	}
+	return username, password, nil
+}
+
+// ThermostatOptions returns the thermostat options configured by the entry.
+// The Credentials reference is resolved with resolve, or EnvCredentials when
+// resolve is nil.
+func (e *InventoryEntry) ThermostatOptions(resolve CredentialsResolver) ([]thermostat.Option, error) {
+	var opts []thermostat.Option
+	if e.Pin != "" {
+		opts = append(opts, thermostat.WithPin(e.Pin))
+	}
+	if e.Credentials != "" {
+		if resolve == nil {
+			resolve = EnvCredentials
+		}
+		username, password, err := resolve(e.Credentials)
+		if err != nil {
+			return nil, fmt.Errorf("device %s: %w", e.Alias, err)
+		}
+		opts = append(opts, thermostat.WithCredentials(username, password))
+	}
+	return opts, nil
+}
+
+// Inventory is a collection of named devices which may be loaded from and
+// saved to a json file. Json is the only supported file format.
+type Inventory struct {
+	Devices []*InventoryEntry `json:"devices"`
+}
+
+// LoadInventory reads the inventory json file at path.
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading inventory: %w", err)
+	}
+	var inv Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("decoding inventory %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for _, entry := range inv.Devices {
+		if entry.Alias == "" {
+			return nil, fmt.Errorf("inventory %s: device %s missing alias", path, entry.Address)
+		}
+		if seen[entry.Alias] {
+			return nil, fmt.Errorf("inventory %s: duplicate alias %q", path, entry.Alias)
+		}
+		seen[entry.Alias] = true
+	}
+	return &inv, nil
+}
+
+// Save writes the inventory to path as json. The file is replaced atomically
+// and is only readable by the owner as it may contain pins.
+func (inv *Inventory) Save(path string) error {
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding inventory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("saving inventory: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving inventory: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving inventory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("saving inventory: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the entry with the provided alias, or nil if there is none.
+func (inv *Inventory) Lookup(alias string) *InventoryEntry {
+	for _, entry := range inv.Devices {
+		if entry.Alias == alias {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Tagged returns the entries tagged with tag.
+func (inv *Inventory) Tagged(tag string) []*InventoryEntry {
+	var entries []*InventoryEntry
+	for _, entry := range inv.Devices {
+		if entry.HasTag(tag) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Resolve returns the entries for args, each an alias or an address. Args
+// which aren't an alias in the inventory are returned as an entry using the
+// arg as both the alias and address. Without any args every entry is
+// returned, limited to those tagged with tag when set. Resolve may be called
+// on a nil Inventory, in which case every arg is an address.
+func (inv *Inventory) Resolve(args []string, tag string) []*InventoryEntry {
+	if len(args) == 0 {
+		switch {
+		case inv == nil:
+			return nil
+		case tag != "":
+			return inv.Tagged(tag)
+		}
+		return inv.Devices
+	}
+	entries := make([]*InventoryEntry, 0, len(args))
+	for _, arg := range args {
+		var entry *InventoryEntry
+		if inv != nil {
+			entry = inv.Lookup(arg)
+		}
+		if entry == nil {
+			entry = &InventoryEntry{Alias: arg, Address: arg}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Add adds the entry to the inventory, returning an error if the alias is
+// already in use.
+func (inv *Inventory) Add(entry *InventoryEntry) error {
+	if entry.Alias == "" {
+		return fmt.Errorf("device %s missing alias", entry.Address)
+	}
+	if inv.Lookup(entry.Alias) != nil {
+		return fmt.Errorf("duplicate alias %q", entry.Alias)
+	}
+	inv.Devices = append(inv.Devices, entry)
+	return nil
+}
+
+// Merge updates the inventory with freshly discovered or probed devices.
+// Devices are matched to entries by MAC address, falling back to the address
+// when either MAC is unknown. Matched entries have their address, name, MAC
+// and type updated, keeping entries current when DHCP addresses change.
+// Devices with no match are added with an alias derived from their name.
+// The entries added or changed are returned.
+func (inv *Inventory) Merge(devices ...*Device) []*InventoryEntry {
+	var changed []*InventoryEntry
+	for _, device := range devices {
+		entry := inv.match(device)
+		if entry == nil {
+			entry = &InventoryEntry{
+				Alias:   inv.uniqueAlias(device),
+				Address: device.Address,
+				Type:    device.Type,
+				Name:    device.Name,
+				MAC:     device.MAC,
+			}
+			inv.Devices = append(inv.Devices, entry)
+			changed = append(changed, entry)
+			continue
+		}
+		updated := *entry
+		updated.Address = device.Address
+		if device.Name != "" {
+			updated.Name = device.Name
+		}
+		if device.MAC != "" {
+			updated.MAC = device.MAC
+		}
+		if device.Type != "" && (device.Type != TypeThermostat || updated.Type == "") {
+			updated.Type = device.Type
+		}
+		if !updated.equal(entry) {
+			*entry = updated
+			changed = append(changed, entry)
+		}
+	}
+	return changed
+}
+
+func (inv *Inventory) match(device *Device) *InventoryEntry {
+	if device.MAC != "" {
+		for _, entry := range inv.Devices {
+			if entry.MAC != "" && strings.EqualFold(entry.MAC, device.MAC) {
+				return entry
+			}
+		}
+	}
+	for _, entry := range inv.Devices {
+		if (entry.MAC == "" || device.MAC == "") && entry.Address == device.Address {
+			return entry
+		}
+	}
+	return nil
+}
+
+// uniqueAlias derives an alias for the device which is not yet in use.
+func (inv *Inventory) uniqueAlias(device *Device) string {
+	base := strings.ToLower(strings.Join(strings.FieldsFunc(device.Name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}), "-"))
+	if base == "" {
+		base = strings.ReplaceAll(strings.ToLower(device.MAC), ":", "")
+	}
+	if base == "" {
+		base = device.Address
+	}
+	alias := base
+	for i := 2; inv.Lookup(alias) != nil; i++ {
+		alias = fmt.Sprintf("%s-%d", base, i)
+	}
+	return alias
+}
+
+func (e *InventoryEntry) equal(o *InventoryEntry) bool {
+	return e.Alias == o.Alias && e.Address == o.Address && e.Type == o.Type &&
+		e.Name == o.Name && e.MAC == o.MAC
+}
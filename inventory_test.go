@@ -0,0 +1,270 @@
+package venstar
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+func testInventory() *Inventory {
+	return &Inventory{
+		Devices: []*InventoryEntry{
+			{Alias: "living-room", Address: "192.168.1.10", Type: TypeResidential, MAC: "00:23:a7:00:00:01", Pin: "1234", Tags: []string{"upstairs", "home"}},
+			{Alias: "office", Address: "192.168.1.11", Type: TypeCommercial, MAC: "00:23:a7:00:00:02", Credentials: "office-secret", Tags: []string{"work"}},
+			{Alias: "garage", Address: "192.168.1.12", Type: TypeThermostat, Tags: []string{"home"}},
+		},
+	}
+}
+
+func TestInventorySaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	inv := testInventory()
+	if err := inv.Save(path); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if perm := stat.Mode().Perm(); perm != 0o600 {
+		t.Errorf("file mode invalid, got: %o want: 600", perm)
+	}
+
+	loaded, err := LoadInventory(path)
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if !reflect.DeepEqual(loaded, inv) {
+		t.Errorf("loaded inventory invalid, got: %+v want: %+v", loaded, inv)
+	}
+}
+
+func TestLoadInventory(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		expErr string
+	}{
+		{"valid", `{"devices": [{"alias": "a", "address": "10.0.0.1", "type": "thermostat"}]}`, ""},
+		{"invalid json", `{"devices": [`, "decoding inventory"},
+		{"missing alias", `{"devices": [{"address": "10.0.0.1"}]}`, "device 10.0.0.1 missing alias"},
+		{"duplicate alias", `{"devices": [{"alias": "a"}, {"alias": "a"}]}`, `duplicate alias "a"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "inventory.json")
+			if err := os.WriteFile(path, []byte(test.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadInventory(path)
+			if test.expErr == "" && err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			if test.expErr != "" && (err == nil || !strings.Contains(err.Error(), test.expErr)) {
+				t.Error("error invalid, got:", err, "want:", test.expErr)
+			}
+		})
+	}
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadInventory(filepath.Join(t.TempDir(), "missing.json"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Error("error invalid, got:", err, "want: not exist")
+		}
+	})
+}
+
+func TestInventoryLookup(t *testing.T) {
+	inv := testInventory()
+	if entry := inv.Lookup("office"); entry == nil || entry.Address != "192.168.1.11" {
+		t.Error("office entry invalid, got:", entry)
+	}
+	if entry := inv.Lookup("attic"); entry != nil {
+		t.Error("entry unexpectedly found:", entry)
+	}
+
+	var aliases []string
+	for _, entry := range inv.Tagged("home") {
+		aliases = append(aliases, entry.Alias)
+	}
+	if want := []string{"living-room", "garage"}; !reflect.DeepEqual(aliases, want) {
+		t.Error("tagged entries invalid, got:", aliases, "want:", want)
+	}
+	if entries := inv.Tagged("attic"); len(entries) != 0 {
+		t.Error("tagged entries unexpectedly found:", entries)
+	}
+}
+
+func TestInventoryResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		inv  *Inventory
+		args []string
+		tag  string
+		want []string
+	}{
+		{"all entries", testInventory(), nil, "", []string{"living-room=192.168.1.10", "office=192.168.1.11", "garage=192.168.1.12"}},
+		{"tagged entries", testInventory(), nil, "home", []string{"living-room=192.168.1.10", "garage=192.168.1.12"}},
+		{"aliases and addresses", testInventory(), []string{"office", "10.0.0.5"}, "home", []string{"office=192.168.1.11", "10.0.0.5=10.0.0.5"}},
+		{"nil inventory", nil, []string{"office"}, "", []string{"office=office"}},
+		{"nil inventory without args", nil, nil, "home", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, entry := range test.inv.Resolve(test.args, test.tag) {
+				got = append(got, entry.Alias+"="+entry.Address)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Error("entries invalid, got:", got, "want:", test.want)
+			}
+		})
+	}
+}
+
+func TestInventoryAdd(t *testing.T) {
+	inv := testInventory()
+	if err := inv.Add(&InventoryEntry{Alias: "attic", Address: "192.168.1.13"}); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if err := inv.Add(&InventoryEntry{Alias: "attic", Address: "192.168.1.14"}); err == nil {
+		t.Error("duplicate alias unexpectedly added")
+	}
+	if err := inv.Add(&InventoryEntry{Address: "192.168.1.14"}); err == nil {
+		t.Error("missing alias unexpectedly added")
+	}
+	if len(inv.Devices) != 4 {
+		t.Error("device count invalid, got:", len(inv.Devices), "want:", 4)
+	}
+}
+
+func TestInventoryMerge(t *testing.T) {
+	inv := testInventory()
+	changed := inv.Merge(
+		// DHCP address changed, matched by MAC.
+		&Device{Type: TypeThermostat, Address: "192.168.1.50", MAC: "00:23:A7:00:00:01", Name: "Living Room"},
+		// Unchanged.
+		&Device{Type: TypeCommercial, Address: "192.168.1.11", MAC: "00:23:a7:00:00:02"},
+		// Matched by address, learns MAC and type.
+		&Device{Type: TypeResidential, Address: "192.168.1.12", MAC: "00:23:a7:00:00:03"},
+		// New devices.
+		&Device{Type: TypeThermostat, Address: "192.168.1.60", MAC: "00:23:a7:00:00:04", Name: "Office"},
+		&Device{Type: TypeThermostat, Address: "192.168.1.61", MAC: "00:23:a7:00:00:05"},
+	)
+
+	var aliases []string
+	for _, entry := range changed {
+		aliases = append(aliases, entry.Alias)
+	}
+	if want := []string{"living-room", "garage", "office-2", "0023a7000005"}; !reflect.DeepEqual(aliases, want) {
+		t.Error("changed entries invalid, got:", aliases, "want:", want)
+	}
+
+	living := inv.Lookup("living-room")
+	if living.Address != "192.168.1.50" {
+		t.Error("address invalid, got:", living.Address, "want: 192.168.1.50")
+	}
+	if living.Type != TypeResidential {
+		t.Error("type invalid, got:", living.Type, "want:", TypeResidential)
+	}
+	if living.Pin != "1234" || len(living.Tags) != 2 {
+		t.Errorf("configured fields not preserved, got: %+v", living)
+	}
+
+	garage := inv.Lookup("garage")
+	if garage.MAC != "00:23:a7:00:00:03" || garage.Type != TypeResidential {
+		t.Errorf("garage entry invalid, got: %+v", garage)
+	}
+	if len(inv.Devices) != 5 {
+		t.Error("device count invalid, got:", len(inv.Devices), "want:", 5)
+	}
+}
+
+func TestInventoryEntryDevice(t *testing.T) {
+	entry := &InventoryEntry{Alias: "office", Address: "192.168.1.11", Type: TypeCommercial, Name: "Office", MAC: "00:23:a7:00:00:02", Pin: "1234"}
+	device, err := entry.Device()
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if device.Type != entry.Type || device.Address != entry.Address || device.Name != entry.Name || device.MAC != entry.MAC {
+		t.Errorf("device invalid, got: %+v", device)
+	}
+	opts, err := entry.ThermostatOptions(nil)
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if len(opts) != 1 {
+		t.Error("options invalid, got:", len(opts), "want:", 1)
+	}
+
+	entry.Type = "sensor"
+	if _, err := entry.Device(); err == nil {
+		t.Error("unknown type unexpectedly accepted")
+	}
+}
+
+func TestInventoryEntryCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "admin" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="venstar"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"api_ver": 7, "type": "residential"}`)
+	}))
+	defer server.Close()
+	entry := &InventoryEntry{Alias: "office", Address: strings.TrimPrefix(server.URL, "http://"), Credentials: "office-secret"}
+
+	t.Run("resolver", func(t *testing.T) {
+		var got string
+		opts, err := entry.ThermostatOptions(func(ref string) (string, string, error) {
+			got = ref
+			return "admin", "secret", nil
+		})
+		if err != nil {
+			t.Fatal("error unexpectedly returned: ", err)
+		}
+		if got != "office-secret" {
+			t.Error("reference invalid, got:", got, "want: office-secret")
+		}
+		if _, err := thermostat.New(entry.Address, opts...).GetAPIInfo(); err != nil {
+			t.Error("error unexpectedly returned: ", err)
+		}
+	})
+	t.Run("resolver errors get returned", func(t *testing.T) {
+		_, err := entry.ThermostatOptions(func(string) (string, string, error) {
+			return "", "", errors.New("this is an error")
+		})
+		if err == nil || err.Error() != "device office: this is an error" {
+			t.Error("error invalid, got:", err, "want: device office: this is an error")
+		}
+	})
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv("OFFICE_SECRET_USERNAME", "admin")
+		t.Setenv("OFFICE_SECRET_PASSWORD", "secret")
+		opts, err := entry.ThermostatOptions(nil)
+		if err != nil {
+			t.Fatal("error unexpectedly returned: ", err)
+		}
+		if _, err := thermostat.New(entry.Address, opts...).GetAPIInfo(); err != nil {
+			t.Error("error unexpectedly returned: ", err)
+		}
+	})
+	t.Run("environment unset", func(t *testing.T) {
+		t.Setenv("OFFICE_SECRET_USERNAME", "admin")
+		_, err := entry.ThermostatOptions(nil)
+		want := `device office: credentials "office-secret": $OFFICE_SECRET_PASSWORD not set`
+		if err == nil || err.Error() != want {
+			t.Error("error invalid, got:", err, "want:", want)
+		}
+	})
+}
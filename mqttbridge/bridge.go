@@ -0,0 +1,323 @@
+// Package mqttbridge publishes Venstar thermostat state over MQTT and applies
+// updates received on command topics.
+//
+// The bridge publishes online to <prefix>/availability while it is running,
+// and its Will publishes offline if the bridge is lost. For each device, the
+// bridge publishes retained messages under <prefix>/<id>:
+//
+//	availability         online or offline
+//	info                 QueryInfo as json
+//	sensors              sensors as json
+//	sensors/<sensor>     sensor temperature
+//	alerts               alerts as json
+//	alerts/<alert>       ON or OFF
+//
+// Commands are received on <prefix>/<id>/set/<command>, see Bridge.Command.
+// Home Assistant discovery configs are published for a climate entity along
+// with sensor and binary sensor entities for the sensors and alerts.
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+// Bridge defaults.
+const (
+	DefaultPrefix          = "venstar"
+	DefaultDiscoveryPrefix = "homeassistant"
+	DefaultInterval        = 30 * time.Second
+)
+
+// commandQueueSize is the number of commands queued for a device while it is
+// handling a command. Further commands for the device are dropped.
+const commandQueueSize = 8
+
+// Client publishes and subscribes to messages on an MQTT broker. It is
+// implemented by Conn.
+type Client interface {
+	Publish(ctx context.Context, msg *Message) error
+	Subscribe(ctx context.Context, filter string, handler func(*Message)) error
+}
+
+// Device is a thermostat bridged to MQTT.
+type Device struct {
+	// ID identifies the thermostat within topics, such as its inventory
+	// alias. It must not contain /, + or #.
+	ID         string
+	Thermostat *thermostat.Thermostat
+}
+
+// Bridge polls thermostats, publishing their state, and applies commands
+// received from the broker.
+type Bridge struct {
+	Client  Client
+	Devices []*Device
+	// Prefix is the base of the state and command topics. Defaults to
+	// DefaultPrefix.
+	Prefix string
+	// DiscoveryPrefix is the Home Assistant discovery prefix. Defaults to
+	// DefaultDiscoveryPrefix.
+	DiscoveryPrefix string
+	// DisableDiscovery stops Home Assistant discovery configs being
+	// published.
+	DisableDiscovery bool
+	// Interval is the delay between polls. Defaults to DefaultInterval.
+	Interval time.Duration
+	// OnError is called with errors polling thermostats, publishing and
+	// handling commands.
+	OnError func(error)
+
+	mu         sync.Mutex
+	discovered map[string]bool
+}
+
+// New creates a Bridge publishing the devices using the client.
+func New(client Client, devices ...*Device) *Bridge {
+	return &Bridge{Client: client, Devices: devices}
+}
+
+func (b *Bridge) prefix() string {
+	if b.Prefix == "" {
+		return DefaultPrefix
+	}
+	return b.Prefix
+}
+
+func (b *Bridge) discoveryPrefix() string {
+	if b.DiscoveryPrefix == "" {
+		return DefaultDiscoveryPrefix
+	}
+	return b.DiscoveryPrefix
+}
+
+// AvailabilityTopic returns the topic the bridge's own availability is
+// published to.
+func (b *Bridge) AvailabilityTopic() string {
+	return b.prefix() + "/availability"
+}
+
+// Will returns the message to set as the ConnectOptions Will, marking the
+// bridge offline if its connection is lost.
+func (b *Bridge) Will() *Message {
+	return retained(b.AvailabilityTopic(), []byte("offline"))
+}
+
+func (b *Bridge) topic(dev *Device, parts ...string) string {
+	return strings.Join(append([]string{b.prefix(), dev.ID}, parts...), "/")
+}
+
+func (b *Bridge) reportError(err error) {
+	if err != nil && b.OnError != nil {
+		b.OnError(err)
+	}
+}
+
+// Run subscribes to the command topics and publishes the state of each device
+// every interval until ctx is done. Commands are applied one at a time for
+// each device, and retained commands are ignored. The bridge is published as
+// online once subscribed and offline when Run returns. Run returns the
+// context's error, or an error if subscribing fails.
+func (b *Bridge) Run(ctx context.Context) error {
+	queues := make(map[string]chan *Message, len(b.Devices))
+	for _, dev := range b.Devices {
+		queues[dev.ID] = make(chan *Message, commandQueueSize)
+	}
+	err := b.Client.Subscribe(ctx, b.prefix()+"/+/set/+", func(msg *Message) {
+		// Retained commands are left over from before the bridge connected,
+		// so applying them would repeat a stale command.
+		if msg.Retain {
+			return
+		}
+		// Commands query the thermostat, so they are handled outside of the
+		// client's read loop.
+		id, _, ok := b.commandTopic(msg.Topic)
+		if !ok {
+			return
+		}
+		queue := queues[id]
+		if queue == nil {
+			b.reportError(fmt.Errorf("command %s: unknown device %q", msg.Topic, id))
+			return
+		}
+		select {
+		case queue <- msg:
+		default:
+			b.reportError(fmt.Errorf("command %s: too many commands queued for %s, dropped", msg.Topic, id))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("subscribing to commands: %w", err)
+	}
+	for _, dev := range b.Devices {
+		go b.handleCommands(ctx, dev, queues[dev.ID])
+	}
+	if err := b.Client.Publish(ctx, retained(b.AvailabilityTopic(), []byte("online"))); err != nil {
+		return fmt.Errorf("publishing availability: %w", err)
+	}
+	defer func() {
+		// ctx is done, so offline is published with a context of its own.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		b.publish(ctx, b.AvailabilityTopic(), "offline")
+	}()
+
+	interval := b.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		b.PublishAll(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishAll publishes the state of every device concurrently. Errors are
+// reported to OnError.
+func (b *Bridge) PublishAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, dev := range b.Devices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.reportError(b.Publish(ctx, dev))
+		}()
+	}
+	wg.Wait()
+}
+
+// Publish polls the device and publishes its state. The first time the device
+// is reached, its discovery configs are published. If the device can't be
+// reached, it is published as offline.
+func (b *Bridge) Publish(ctx context.Context, dev *Device) error {
+	snap, err := dev.Thermostat.SnapshotSections(ctx, thermostat.SectionQueryInfo, thermostat.SectionSensors, thermostat.SectionAlerts)
+	if err != nil {
+		b.publish(ctx, b.topic(dev, "availability"), "offline")
+		return fmt.Errorf("publishing %s: %w", dev.ID, err)
+	}
+	info, sensors, alerts := snap.QueryInfo, snap.Sensors, snap.Alerts
+
+	if !b.DisableDiscovery && b.needsDiscovery(dev) {
+		if err := b.publishDiscovery(ctx, dev, info, sensors, alerts); err != nil {
+			return fmt.Errorf("publishing %s: %w", dev.ID, err)
+		}
+		b.setDiscovered(dev)
+	}
+
+	msgs := []*Message{
+		retained(b.topic(dev, "info"), mustJSON(info)),
+		retained(b.topic(dev, "sensors"), mustJSON(sensors)),
+		retained(b.topic(dev, "alerts"), mustJSON(alerts)),
+	}
+	for _, sensor := range sensors {
+		msgs = append(msgs, retained(b.topic(dev, "sensors", slug(sensor.Name)), []byte(formatFloat(sensor.Temp))))
+	}
+	for _, alert := range alerts {
+		msgs = append(msgs, retained(b.topic(dev, "alerts", slug(alert.Name)), []byte(onOff(alert.Active))))
+	}
+	msgs = append(msgs, retained(b.topic(dev, "availability"), []byte("online")))
+	for _, msg := range msgs {
+		if err := b.Client.Publish(ctx, msg); err != nil {
+			return fmt.Errorf("publishing %s: %w", dev.ID, err)
+		}
+	}
+	return nil
+}
+
+// publish sends a retained message, ignoring failures. It is used to report
+// availability while already returning an error.
+func (b *Bridge) publish(ctx context.Context, topic, payload string) {
+	b.Client.Publish(ctx, retained(topic, []byte(payload)))
+}
+
+func (b *Bridge) needsDiscovery(dev *Device) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.discovered[dev.ID]
+}
+
+func (b *Bridge) setDiscovered(dev *Device) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.discovered == nil {
+		b.discovered = make(map[string]bool)
+	}
+	b.discovered[dev.ID] = true
+}
+
+// commandTopic splits a <prefix>/<id>/set/<command> topic.
+func (b *Bridge) commandTopic(topic string) (id, command string, ok bool) {
+	rest, ok := strings.CutPrefix(topic, b.prefix()+"/")
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || parts[1] != "set" {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
+
+// handleCommands applies the commands queued for the device until ctx is
+// done, publishing the state after each.
+func (b *Bridge) handleCommands(ctx context.Context, dev *Device, queue <-chan *Message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-queue:
+			_, command, _ := b.commandTopic(msg.Topic)
+			if err := b.Command(ctx, dev, command, string(msg.Payload)); err != nil {
+				b.reportError(err)
+				continue
+			}
+			b.reportError(b.Publish(ctx, dev))
+		}
+	}
+}
+
+func retained(topic string, payload []byte) *Message {
+	return &Message{Topic: topic, Payload: payload, Retain: true}
+}
+
+// mustJSON encodes values which always encode successfully.
+func mustJSON(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func onOff(v bool) string {
+	if v {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// slug returns the name lower cased with characters other than letters and
+// digits replaced with underscores, suitable for topics and entity ids.
+func slug(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,373 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mrm.dev/venstar/thermostat"
+	"go.mrm.dev/venstar/thermostat/thermostattest"
+)
+
+// fakeInfo is the query info served by the stand-in thermostats.
+var fakeInfo = thermostat.QueryInfo{
+	Name:            "Hallway",
+	Mode:            thermostat.ModeHeat,
+	State:           1,
+	SpaceTemp:       68,
+	HeatTemp:        68,
+	CoolTemp:        74,
+	HeatTempMin:     35,
+	HeatTempMax:     90,
+	CoolTempMin:     35,
+	CoolTempMax:     99,
+	SetPointDelta:   4,
+	HumidityEnabled: 1,
+	Humidity:        40,
+}
+
+func dialTestBroker(t *testing.T, broker *testBroker, clientID string) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := Dial(ctx, broker.addr(), &ConnectOptions{ClientID: clientID})
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestBridgePublish(t *testing.T) {
+	broker := newTestBroker(t)
+	fake := thermostattest.NewServer(t, fakeInfo)
+	b := New(dialTestBroker(t, broker, "bridge"), &Device{ID: "hall", Thermostat: fake.Thermostat()})
+
+	if err := b.Publish(context.Background(), b.Devices[0]); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		{"venstar/hall/availability", "online"},
+		{"venstar/hall/sensors/outdoor", "32"},
+		{"venstar/hall/alerts/air_filter", "ON"},
+		{"venstar/hall/alerts/service", "OFF"},
+		{"venstar/hall/sensors", `[{"name":"Thermostat","temp":68},{"name":"Outdoor","temp":32}]`},
+	}
+	for _, test := range tests {
+		if got := broker.waitRetained(t, test.topic, test.want); got != test.want {
+			t.Error(test.topic, "invalid, got:", got, "want:", test.want)
+		}
+	}
+
+	var info thermostat.QueryInfo
+	if err := json.Unmarshal(broker.getRetained("venstar/hall/info").Payload, &info); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if info.Name != "Hallway" || info.HeatTemp != 68 {
+		t.Error("info invalid, got:", info.Name, info.HeatTemp)
+	}
+
+	var climate map[string]interface{}
+	if err := json.Unmarshal(broker.getRetained("homeassistant/climate/venstar_hall/config").Payload, &climate); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	checks := map[string]interface{}{
+		"unique_id":                     "venstar_hall_climate",
+		"mode_command_topic":            "venstar/hall/set/mode",
+		"temperature_low_command_topic": "venstar/hall/set/heat_temp",
+		"preset_mode_command_topic":     "venstar/hall/set/away",
+		"current_humidity_topic":        "venstar/hall/info",
+		"temperature_unit":              "F",
+		"temp_step":                     1.0,
+		"max_temp":                      99.0,
+	}
+	for key, want := range checks {
+		if climate[key] != want {
+			t.Error(key, "invalid, got:", climate[key], "want:", want)
+		}
+	}
+	wantAvailability := `[{"topic":"venstar/availability"},{"topic":"venstar/hall/availability"}]`
+	if got, _ := json.Marshal(climate["availability"]); string(got) != wantAvailability || climate["availability_mode"] != "all" {
+		t.Error("availability invalid, got:", string(got), climate["availability_mode"], "want:", wantAvailability, "all")
+	}
+	if device, _ := climate["device"].(map[string]interface{}); device["model"] != "COLORTOUCH" || device["name"] != "Hallway" {
+		t.Error("device invalid, got:", device)
+	}
+
+	for _, topic := range []string{
+		"homeassistant/sensor/venstar_hall_sensor_outdoor/config",
+		"homeassistant/sensor/venstar_hall_humidity/config",
+		"homeassistant/binary_sensor/venstar_hall_alert_air_filter/config",
+	} {
+		if broker.getRetained(topic) == nil {
+			t.Error("discovery config missing:", topic)
+		}
+	}
+}
+
+func TestBridgePublishUnreachable(t *testing.T) {
+	broker := newTestBroker(t)
+	down := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(down.Close)
+	b := New(dialTestBroker(t, broker, "bridge"), &Device{
+		ID:         "hall",
+		Thermostat: thermostat.New(strings.TrimPrefix(down.URL, "http://")),
+	})
+	if err := b.Publish(context.Background(), b.Devices[0]); err == nil {
+		t.Fatal("error expected")
+	}
+	if got := broker.waitRetained(t, "venstar/hall/availability", "offline"); got != "offline" {
+		t.Error("availability invalid, got:", got, "want: offline")
+	}
+	if broker.getRetained("homeassistant/climate/venstar_hall/config") != nil {
+		t.Error("discovery unexpectedly published")
+	}
+}
+
+func TestBridgeCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		payload string
+		want    url.Values
+		err     error
+	}{
+		{"mode", "heat_cool", url.Values{"mode": {"3"}, "fan": {"0"}, "heattemp": {"68"}, "cooltemp": {"74"}}, nil},
+		{"fan", "on", url.Values{"mode": {"1"}, "fan": {"1"}, "heattemp": {"68"}, "cooltemp": {"74"}}, nil},
+		{"temperature", "72", url.Values{"mode": {"1"}, "fan": {"0"}, "heattemp": {"72"}, "cooltemp": {"76"}}, nil},
+		{"cool_temp", "70", url.Values{"mode": {"1"}, "fan": {"0"}, "heattemp": {"66"}, "cooltemp": {"70"}}, nil},
+		{"away", "away", url.Values{"away": {"1"}}, nil},
+		{"away", "none", url.Values{"away": {"0"}}, nil},
+		{"dehumidify_setpoint", "55", url.Values{"dehum_setpoint": {"55"}}, nil},
+		{"mode", "dry", nil, ErrInvalidCommand},
+		{"heat_temp", "warm", nil, ErrInvalidCommand},
+		{"humidify_setpoint", "40.5", nil, ErrInvalidCommand},
+		{"reboot", "", nil, ErrInvalidCommand},
+		{"heat_temp", "20", nil, thermostat.ErrValidation},
+	}
+	for _, test := range tests {
+		t.Run(test.command+" "+test.payload, func(t *testing.T) {
+			fake := thermostattest.NewServer(t, fakeInfo)
+			b := New(nil)
+			err := b.Command(context.Background(), &Device{ID: "hall", Thermostat: fake.Thermostat()}, test.command, test.payload)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatal("error invalid, got:", err, "want:", test.err)
+				}
+				if fake.LastUpdate() != nil {
+					t.Error("update unexpectedly sent, got:", fake.LastUpdate())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			if got := fake.LastUpdate().Encode(); got != test.want.Encode() {
+				t.Error("update invalid, got:", got, "want:", test.want.Encode())
+			}
+		})
+	}
+	t.Run("temperature requires heat or cool", func(t *testing.T) {
+		fake := thermostattest.NewServer(t, fakeInfo)
+		fake.UpdateInfo(func(info *thermostat.QueryInfo) { info.Mode = thermostat.ModeAuto })
+		err := New(nil).Command(context.Background(), &Device{ID: "hall", Thermostat: fake.Thermostat()}, "temperature", "70")
+		if !errors.Is(err, ErrInvalidCommand) {
+			t.Error("error invalid, got:", err, "want:", ErrInvalidCommand)
+		}
+	})
+}
+
+func TestBridgeRun(t *testing.T) {
+	broker := newTestBroker(t)
+	fake := thermostattest.NewServer(t, fakeInfo)
+	errs := make(chan error, 10)
+	b := New(dialTestBroker(t, broker, "bridge"), &Device{ID: "hall", Thermostat: fake.Thermostat()})
+	b.Interval = time.Hour
+	b.OnError = func(err error) { errs <- err }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+
+	if got := broker.waitRetained(t, "venstar/hall/availability", "online"); got != "online" {
+		t.Fatal("availability invalid, got:", got, "want: online")
+	}
+	if got := broker.waitRetained(t, "venstar/availability", "online"); got != "online" {
+		t.Error("bridge availability invalid, got:", got, "want: online")
+	}
+
+	client := dialTestBroker(t, broker, "home-assistant")
+	if err := client.Publish(ctx, &Message{Topic: "venstar/hall/set/mode", Payload: []byte("cool")}); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if err := client.Publish(ctx, &Message{Topic: "venstar/basement/set/mode", Payload: []byte("cool")}); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+
+	// State is published again after the command is applied.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var info thermostat.QueryInfo
+		json.Unmarshal(broker.getRetained("venstar/hall/info").Payload, &info)
+		if info.Mode == thermostat.ModeCool {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := fake.LastUpdate().Get("mode"); got != "2" {
+		t.Error("mode invalid, got:", got, "want: 2")
+	}
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), `unknown device "basement"`) {
+			t.Error("error invalid, got:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("unknown device error not reported")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Error("error invalid, got:", err, "want:", context.Canceled)
+	}
+	if got := broker.waitRetained(t, "venstar/availability", "offline"); got != "offline" {
+		t.Error("bridge availability invalid, got:", got, "want: offline")
+	}
+}
+
+func TestBridgeWill(t *testing.T) {
+	broker := newTestBroker(t)
+	b := New(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := Dial(ctx, broker.addr(), &ConnectOptions{ClientID: "bridge", Will: b.Will()})
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	// Drop the connection without a DISCONNECT, as when the bridge crashes.
+	conn.conn.Close()
+	if got := broker.waitRetained(t, "venstar/availability", "offline"); got != "offline" {
+		t.Error("bridge availability invalid, got:", got, "want: offline")
+	}
+}
+
+// subscribeClient records the handler subscribed, discarding publishes.
+type subscribeClient struct {
+	subscribed chan func(*Message)
+}
+
+func (c *subscribeClient) Publish(context.Context, *Message) error {
+	return nil
+}
+
+func (c *subscribeClient) Subscribe(_ context.Context, _ string, handler func(*Message)) error {
+	c.subscribed <- handler
+	return nil
+}
+
+func TestBridgeRunQueuesCommands(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	started := make(chan struct{}, commandQueueSize+1)
+	release := make(chan struct{})
+	tstat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/query/info":
+			json.NewEncoder(w).Encode(fakeInfo)
+		case "/control":
+			if n := inFlight.Add(1); n > peak.Load() {
+				peak.Store(n)
+			}
+			defer inFlight.Add(-1)
+			started <- struct{}{}
+			<-release
+			w.Write([]byte(`{"success": true}`))
+		default:
+			w.Write([]byte(thermostattest.DefaultBodies[r.URL.Path]))
+		}
+	}))
+	t.Cleanup(tstat.Close)
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+
+	client := &subscribeClient{subscribed: make(chan func(*Message), 1)}
+	errs := make(chan error, 100)
+	b := New(client, &Device{ID: "hall", Thermostat: thermostat.New(strings.TrimPrefix(tstat.URL, "http://"))})
+	b.Interval = time.Hour
+	b.OnError = func(err error) { errs <- err }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+	handler := <-client.subscribed
+
+	cmd := &Message{Topic: "venstar/hall/set/fan", Payload: []byte("on")}
+	handler(cmd)
+	<-started
+	for range commandQueueSize {
+		handler(cmd)
+	}
+	select {
+	case err := <-errs:
+		t.Fatal("error unexpectedly returned: ", err)
+	default:
+	}
+	handler(cmd)
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "too many commands queued") {
+			t.Error("error invalid, got:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dropped command not reported")
+	}
+
+	unblock()
+	for range commandQueueSize {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("queued command not applied")
+		}
+	}
+	if got := peak.Load(); got != 1 {
+		t.Error("concurrent commands invalid, got:", got, "want: 1")
+	}
+}
+
+func TestBridgeRunIgnoresRetainedCommands(t *testing.T) {
+	fake := thermostattest.NewServer(t, fakeInfo)
+	client := &subscribeClient{subscribed: make(chan func(*Message), 1)}
+	b := New(client, &Device{ID: "hall", Thermostat: fake.Thermostat()})
+	b.Interval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+	handler := <-client.subscribed
+
+	handler(&Message{Topic: "venstar/hall/set/fan", Payload: []byte("on"), Retain: true})
+	handler(&Message{Topic: "venstar/hall/set/mode", Payload: []byte("cool")})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.Updates()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	updates := fake.Updates()
+	if len(updates) != 1 {
+		t.Fatal("updates invalid, got:", updates, "want: 1 update")
+	}
+	if got := updates[0].Get("fan"); got != "0" {
+		t.Error("retained fan command applied, got:", got, "want: 0")
+	}
+	if got := updates[0].Get("mode"); got != "2" {
+		t.Error("mode invalid, got:", got, "want: 2")
+	}
+}
@@ -0,0 +1,195 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is an in-process MQTT broker stand-in supporting QoS 0
+// publishing, retained messages and subscriptions.
+type testBroker struct {
+	ln       net.Listener
+	password string
+	// ignorePings stops the broker responding to pings.
+	ignorePings bool
+
+	mu       sync.Mutex
+	retained map[string]*Message
+	subs     map[net.Conn][]string
+	writeMu  map[net.Conn]*sync.Mutex
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	b := &testBroker{
+		ln:       ln,
+		retained: make(map[string]*Message),
+		subs:     make(map[net.Conn][]string),
+		writeMu:  make(map[net.Conn]*sync.Mutex),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go b.serve()
+	return b
+}
+
+func (b *testBroker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) send(conn net.Conn, p *packet) {
+	data, _ := p.encode()
+	b.mu.Lock()
+	mu := b.writeMu[conn]
+	b.mu.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
+	conn.Write(data)
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	p, err := readPacket(r)
+	if err != nil || p.typ != packetConnect {
+		return
+	}
+	pr := &packetReader{body: p.body}
+	pr.string() // protocol name
+	pr.body = pr.body[1:]
+	flags := pr.body[0]
+	pr.body = pr.body[1:]
+	pr.uint16() // keep alive
+	pr.string() // client id
+	var will *Message
+	if flags&0x04 != 0 {
+		will = &Message{Topic: pr.string(), Payload: pr.bytes(), Retain: flags&0x20 != 0}
+	}
+	if flags&0x80 != 0 {
+		pr.string()
+	}
+	var password string
+	if flags&0x40 != 0 {
+		password = pr.string()
+	}
+	b.mu.Lock()
+	b.writeMu[conn] = &sync.Mutex{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.subs, conn)
+		b.mu.Unlock()
+	}()
+	if password != b.password {
+		b.send(conn, &packet{typ: packetConnAck, body: []byte{0, 4}})
+		return
+	}
+	b.send(conn, &packet{typ: packetConnAck, body: []byte{0, 0}})
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			// The will is published when the connection is lost without a
+			// DISCONNECT.
+			if will != nil {
+				b.publish(will)
+			}
+			return
+		}
+		switch p.typ {
+		case packetSubscribe:
+			pr := &packetReader{body: p.body}
+			id := p.body[:2]
+			pr.uint16()
+			filter := pr.string()
+			b.mu.Lock()
+			b.subs[conn] = append(b.subs[conn], filter)
+			var retained []*Message
+			for topic, msg := range b.retained {
+				if matchTopic(filter, topic) {
+					retained = append(retained, msg)
+				}
+			}
+			b.mu.Unlock()
+			b.send(conn, &packet{typ: packetSubAck, body: append(append([]byte{}, id...), 0)})
+			for _, msg := range retained {
+				p, _ := publishPacket(msg)
+				b.send(conn, p)
+			}
+		case packetPublish:
+			msg, _, _, err := parsePublish(p)
+			if err != nil {
+				return
+			}
+			b.publish(msg)
+		case packetPingReq:
+			if !b.ignorePings {
+				b.send(conn, &packet{typ: packetPingResp})
+			}
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+func (b *testBroker) publish(msg *Message) {
+	b.mu.Lock()
+	if msg.Retain {
+		b.retained[msg.Topic] = msg
+	}
+	var conns []net.Conn
+	for conn, filters := range b.subs {
+		for _, filter := range filters {
+			if matchTopic(filter, msg.Topic) {
+				conns = append(conns, conn)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	forward := &Message{Topic: msg.Topic, Payload: msg.Payload}
+	for _, conn := range conns {
+		p, _ := publishPacket(forward)
+		b.send(conn, p)
+	}
+}
+
+func (b *testBroker) getRetained(topic string) *Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retained[topic]
+}
+
+// waitRetained waits for a retained message on the topic with a payload
+// matching want, returning the last payload seen.
+func (b *testBroker) waitRetained(t *testing.T, topic, want string) string {
+	t.Helper()
+	var got string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if msg := b.getRetained(topic); msg != nil {
+			got = string(msg.Payload)
+			if got == want {
+				return got
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return got
+}
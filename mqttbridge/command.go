@@ -0,0 +1,170 @@
+package mqttbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+// ErrInvalidCommand is returned for unknown commands and unexpected payloads.
+var ErrInvalidCommand = errors.New("invalid command")
+
+// Command applies a command received on <prefix>/<id>/set/<command>.
+//
+// Control commands are applied with ModifyControls, preserving the other
+// controls:
+//
+//	mode         off, heat, cool, auto or heat_cool
+//	fan          auto or on
+//	temperature  set point for the current mode, heat or cool
+//	heat_temp    heat set point
+//	cool_temp    cool set point
+//
+// Settings commands are validated against the current query info:
+//
+//	away                 away, home or none
+//	schedule             on or off
+//	humidify_setpoint    humidify set point
+//	dehumidify_setpoint  dehumidify set point
+func (b *Bridge) Command(ctx context.Context, dev *Device, command, payload string) error {
+	if err := runCommand(ctx, dev.Thermostat, command, strings.TrimSpace(payload)); err != nil {
+		return fmt.Errorf("handling %s %s command: %w", dev.ID, command, err)
+	}
+	return nil
+}
+
+func runCommand(ctx context.Context, t *thermostat.Thermostat, command, payload string) error {
+	switch command {
+	case "mode":
+		mode, err := parseMode(payload)
+		if err != nil {
+			return err
+		}
+		return t.ModifyControls(ctx, func(cr *thermostat.ControlRequest) {
+			cr.SetMode(int(mode))
+		})
+	case "fan":
+		var fan thermostat.Fan
+		switch payload {
+		case "auto":
+			fan = 0
+		case "on":
+			fan = 1
+		default:
+			return fmt.Errorf("%w: fan %q", ErrInvalidCommand, payload)
+		}
+		return t.ModifyControls(ctx, func(cr *thermostat.ControlRequest) {
+			cr.SetFan(int(fan))
+		})
+	case "temperature":
+		temp, err := parseFloat(payload)
+		if err != nil {
+			return err
+		}
+		info, err := t.GetQueryInfoContext(ctx)
+		if err != nil {
+			return err
+		}
+		switch info.Mode {
+		case thermostat.ModeHeat:
+			command = "heat_temp"
+		case thermostat.ModeCool:
+			command = "cool_temp"
+		default:
+			return fmt.Errorf("%w: temperature requires mode heat or cool, mode is %s", ErrInvalidCommand, info.Mode)
+		}
+		return runCommand(ctx, t, command, formatFloat(temp))
+	case "heat_temp":
+		temp, err := parseFloat(payload)
+		if err != nil {
+			return err
+		}
+		return t.ModifyControls(ctx, func(cr *thermostat.ControlRequest) {
+			cr.SetHeatTemp(temp)
+		})
+	case "cool_temp":
+		temp, err := parseFloat(payload)
+		if err != nil {
+			return err
+		}
+		return t.ModifyControls(ctx, func(cr *thermostat.ControlRequest) {
+			cr.SetCoolTemp(temp)
+		})
+	case "away", "schedule", "humidify_setpoint", "dehumidify_setpoint":
+		return runSettingsCommand(ctx, t, command, payload)
+	}
+	return fmt.Errorf("%w: unknown command", ErrInvalidCommand)
+}
+
+func runSettingsCommand(ctx context.Context, t *thermostat.Thermostat, command, payload string) error {
+	info, err := t.GetQueryInfoContext(ctx)
+	if err != nil {
+		return err
+	}
+	sr := thermostat.NewSettingsRequestFor(info)
+	switch command {
+	case "away":
+		switch payload {
+		case "away":
+			sr.Away()
+		case "home", "none":
+			sr.Home()
+		default:
+			return fmt.Errorf("%w: away %q", ErrInvalidCommand, payload)
+		}
+	case "schedule":
+		switch payload {
+		case "on":
+			sr.ScheduleOn()
+		case "off":
+			sr.ScheduleOff()
+		default:
+			return fmt.Errorf("%w: schedule %q", ErrInvalidCommand, payload)
+		}
+	case "humidify_setpoint", "dehumidify_setpoint":
+		v, err := parseFloat(payload)
+		if err != nil {
+			return err
+		}
+		if v != math.Trunc(v) {
+			return fmt.Errorf("%w: set point %q must be a whole number", ErrInvalidCommand, payload)
+		}
+		if command == "humidify_setpoint" {
+			sr.SetHumidifySetPoint(int(v))
+		} else {
+			sr.SetDehumidifySetPoint(int(v))
+		}
+	}
+	return t.UpdateSettingsContext(ctx, sr)
+}
+
+func parseMode(payload string) (thermostat.Mode, error) {
+	switch payload {
+	case "off":
+		return thermostat.ModeOff, nil
+	case "heat":
+		return thermostat.ModeHeat, nil
+	case "cool":
+		return thermostat.ModeCool, nil
+	case "auto", "heat_cool":
+		return thermostat.ModeAuto, nil
+	}
+	return 0, fmt.Errorf("%w: mode %q", ErrInvalidCommand, payload)
+}
+
+func parseFloat(payload string) (float64, error) {
+	v, err := strconv.ParseFloat(payload, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%w: number %q", ErrInvalidCommand, payload)
+	}
+	return v, nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
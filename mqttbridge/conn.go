@@ -0,0 +1,420 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultKeepAlive is the keep alive interval requested when none is set.
+const DefaultKeepAlive = 60 * time.Second
+
+// writeTimeout bounds the packets written by the connection itself, such as
+// pings and the DISCONNECT sent by Close.
+const writeTimeout = 10 * time.Second
+
+// ErrClosed is returned when using a connection which has been closed or
+// lost.
+var ErrClosed = errors.New("connection closed")
+
+// ConnectError is returned when the broker refuses the connection.
+type ConnectError struct {
+	// Code is the CONNACK return code.
+	Code byte
+}
+
+func (e *ConnectError) Error() string {
+	var reason string
+	switch e.Code {
+	case 1:
+		reason = "unacceptable protocol version"
+	case 2:
+		reason = "identifier rejected"
+	case 3:
+		reason = "server unavailable"
+	case 4:
+		reason = "bad user name or password"
+	case 5:
+		reason = "not authorized"
+	default:
+		reason = fmt.Sprintf("return code %d", e.Code)
+	}
+	return "connection refused: " + reason
+}
+
+// ConnectOptions configures the session requested from the broker.
+type ConnectOptions struct {
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is the maximum time between packets sent to the broker.
+	// The connection is closed if nothing is received from the broker for
+	// one and a half keep alive intervals. Defaults to DefaultKeepAlive.
+	KeepAlive time.Duration
+	// Will is published by the broker if the connection is lost without
+	// being closed.
+	Will *Message
+}
+
+// Conn is a minimal MQTT 3.1.1 client connection.
+//
+// Messages are published with QoS 0 and subscriptions request QoS 0. Each
+// Conn uses a clean session, so subscriptions must be made again after
+// reconnecting.
+type Conn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+	writeMu   sync.Mutex
+
+	mu     sync.Mutex
+	nextID uint16
+	subs   []*subscription
+	acks   map[uint16]chan []byte
+	err    error
+
+	done chan struct{}
+}
+
+type subscription struct {
+	filter  string
+	handler func(*Message)
+}
+
+// Dial connects to the broker at address over tcp.
+func Dial(ctx context.Context, address string, opts *ConnectOptions) (*Conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", address, err)
+	}
+	c, err := Connect(ctx, nc, opts)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Connect starts an MQTT session over an established connection, such as a
+// tls connection.
+func Connect(ctx context.Context, nc net.Conn, opts *ConnectOptions) (*Conn, error) {
+	if opts == nil {
+		opts = &ConnectOptions{}
+	}
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	c := &Conn{
+		conn:      nc,
+		r:         bufio.NewReader(nc),
+		keepAlive: keepAlive,
+		acks:      make(map[uint16]chan []byte),
+		done:      make(chan struct{}),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		nc.SetDeadline(time.Unix(1, 0))
+	})
+	err := c.handshake(opts, keepAlive)
+	if !stop() {
+		return nil, fmt.Errorf("connecting: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting: %w", err)
+	}
+	nc.SetDeadline(time.Time{})
+
+	go c.readLoop()
+	go c.ping()
+	return c, nil
+}
+
+func (c *Conn) handshake(opts *ConnectOptions, keepAlive time.Duration) error {
+	flags := byte(0x02) // clean session
+	w := &packetWriter{}
+	w.string("MQTT")
+	w.byte(4) // protocol level 3.1.1
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	w.byte(flags)
+	w.uint16(uint16(min(keepAlive/time.Second, 0xffff)))
+	w.string(opts.ClientID)
+	if opts.Will != nil {
+		w.string(opts.Will.Topic)
+		w.bytes(opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		w.string(opts.Username)
+	}
+	if opts.Password != "" {
+		w.string(opts.Password)
+	}
+	if w.err != nil {
+		return fmt.Errorf("encoding connect: %w", w.err)
+	}
+	// The deadline set by Connect bounds the handshake.
+	if err := c.writePacket(&packet{typ: packetConnect, body: w.body}, time.Time{}); err != nil {
+		return err
+	}
+
+	p, err := readPacket(c.r)
+	if err != nil {
+		return fmt.Errorf("reading connack: %w", err)
+	}
+	if p.typ != packetConnAck || len(p.body) != 2 {
+		return fmt.Errorf("%w: expected connack, got packet type %d", errMalformedPacket, p.typ)
+	}
+	if code := p.body[1]; code != 0 {
+		return &ConnectError{Code: code}
+	}
+	return nil
+}
+
+// writePacket sends the packet, failing if it isn't written by the deadline.
+// A zero deadline leaves the connection's write deadline unchanged.
+func (c *Conn) writePacket(p *packet, deadline time.Time) error {
+	data, err := p.encode()
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !deadline.IsZero() {
+		c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// write sends the packet before the context's deadline, failing if the
+// connection has been closed.
+func (c *Conn) write(ctx context.Context, p *packet) error {
+	select {
+	case <-c.done:
+		return c.Err()
+	default:
+	}
+	deadline, _ := ctx.Deadline()
+	return c.writePacket(p, deadline)
+}
+
+// Publish sends the message to the broker with QoS 0.
+func (c *Conn) Publish(ctx context.Context, msg *Message) error {
+	p, err := publishPacket(msg)
+	if err == nil {
+		err = c.write(ctx, p)
+	}
+	if err != nil {
+		return fmt.Errorf("publishing %s: %w", msg.Topic, err)
+	}
+	return nil
+}
+
+// Subscribe requests messages matching the topic filter, which may include
+// the + and # wildcards. The handler is called from the connection's read
+// loop, so it must not block.
+func (c *Conn) Subscribe(ctx context.Context, filter string, handler func(*Message)) error {
+	sub := &subscription{filter: filter, handler: handler}
+	ack := make(chan []byte, 1)
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.acks[id] = ack
+	c.subs = append(c.subs, sub)
+	c.mu.Unlock()
+
+	w := &packetWriter{}
+	w.uint16(id)
+	w.string(filter)
+	w.byte(0) // QoS 0
+	err := w.err
+	if err == nil {
+		err = c.write(ctx, &packet{typ: packetSubscribe, flags: 0x02, body: w.body})
+	}
+	if err == nil {
+		select {
+		case codes := <-ack:
+			if len(codes) != 1 || codes[0] == 0x80 {
+				err = errors.New("refused by broker")
+			}
+		case <-c.done:
+			err = c.Err()
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if err != nil {
+		c.mu.Lock()
+		delete(c.acks, id)
+		c.removeSubscription(sub)
+		c.mu.Unlock()
+		return fmt.Errorf("subscribing %s: %w", filter, err)
+	}
+	return nil
+}
+
+func (c *Conn) removeSubscription(sub *subscription) {
+	for i, s := range c.subs {
+		if s == sub {
+			c.subs = append(c.subs[:i], c.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *Conn) readLoop() {
+	for {
+		// The broker responds to pings, so a quiet connection has been lost.
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		p, err := readPacket(c.r)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = fmt.Errorf("nothing received within keep alive: %w", err)
+		}
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+		switch p.typ {
+		case packetPublish:
+			msg, qos, id, err := parsePublish(p)
+			if err != nil {
+				c.shutdown(err)
+				return
+			}
+			if qos == 1 {
+				c.writePacket(&packet{typ: packetPubAck, body: binary.BigEndian.AppendUint16(nil, id)}, time.Now().Add(writeTimeout))
+			}
+			c.dispatch(msg)
+		case packetSubAck:
+			r := &packetReader{body: p.body}
+			id := r.uint16()
+			if r.err != nil {
+				c.shutdown(fmt.Errorf("decoding suback: %w", r.err))
+				return
+			}
+			c.mu.Lock()
+			ack := c.acks[id]
+			delete(c.acks, id)
+			c.mu.Unlock()
+			if ack != nil {
+				ack <- r.body
+			}
+		}
+	}
+}
+
+func (c *Conn) dispatch(msg *Message) {
+	c.mu.Lock()
+	var handlers []func(*Message)
+	for _, sub := range c.subs {
+		if matchTopic(sub.filter, msg.Topic) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	c.mu.Unlock()
+	for _, handler := range handlers {
+		handler(msg)
+	}
+}
+
+// ping sends a ping every half keep alive interval.
+func (c *Conn) ping() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.writePacket(&packet{typ: packetPingReq}, time.Now().Add(writeTimeout)); err != nil {
+				c.shutdown(err)
+				return
+			}
+		}
+	}
+}
+
+// shutdown closes the connection, recording the first error.
+func (c *Conn) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = fmt.Errorf("%w: %w", ErrClosed, err)
+	close(c.done)
+	c.conn.Close()
+}
+
+// Done is closed once the connection is closed or lost.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection was closed, matching ErrClosed, or nil
+// while the connection is open.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close disconnects from the broker. The will message is discarded.
+func (c *Conn) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	err := c.writePacket(&packet{typ: packetDisconnect}, time.Now().Add(writeTimeout))
+	c.shutdown(errors.New("closed by client"))
+	return err
+}
+
+// matchTopic reports whether the topic matches the subscription filter.
+func matchTopic(filter, topic string) bool {
+	// Wildcards do not match topics reserved by the broker.
+	if strings.HasPrefix(topic, "$") && !strings.HasPrefix(filter, "$") {
+		return false
+	}
+	filters := strings.Split(filter, "/")
+	levels := strings.Split(topic, "/")
+	for i, f := range filters {
+		if f == "#" {
+			return true
+		}
+		if i >= len(levels) {
+			return false
+		}
+		if f != "+" && f != levels[i] {
+			return false
+		}
+	}
+	return len(filters) == len(levels)
+}
@@ -0,0 +1,223 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPacketEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		header []byte
+	}{
+		{"empty", 0, []byte{0x30, 0x00}},
+		{"single byte length", 127, []byte{0x30, 0x7f}},
+		{"two byte length", 128, []byte{0x30, 0x80, 0x01}},
+		{"three byte length", 16384, []byte{0x30, 0x80, 0x80, 0x01}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &packet{typ: packetPublish, body: bytes.Repeat([]byte{'a'}, test.length)}
+			data, err := p.encode()
+			if err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			if !bytes.Equal(data[:len(test.header)], test.header) {
+				t.Error("header invalid, got:", data[:len(test.header)], "want:", test.header)
+			}
+			got, err := readPacket(bufio.NewReader(bytes.NewReader(data)))
+			if err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			if got.typ != packetPublish || len(got.body) != test.length {
+				t.Error("packet invalid, got:", got.typ, len(got.body), "want:", packetPublish, test.length)
+			}
+		})
+	}
+}
+
+func TestReadPacketTooLarge(t *testing.T) {
+	p := &packet{typ: packetPublish, body: make([]byte, maxReadLength+1)}
+	data, err := p.encode()
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if _, err := readPacket(bufio.NewReader(bytes.NewReader(data))); !errors.Is(err, errMalformedPacket) {
+		t.Error("error invalid, got:", err, "want:", errMalformedPacket)
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	p, err := publishPacket(&Message{Topic: "a/b", Payload: []byte("on"), Retain: true})
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	msg, qos, _, err := parsePublish(p)
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if msg.Topic != "a/b" || string(msg.Payload) != "on" || !msg.Retain || qos != 0 {
+		t.Error("message invalid, got:", msg.Topic, string(msg.Payload), msg.Retain, qos)
+	}
+
+	// QoS 1 includes a packet identifier after the topic.
+	w := &packetWriter{}
+	w.string("a/b")
+	w.uint16(7)
+	body := append(w.body, "on"...)
+	msg, qos, id, err := parsePublish(&packet{typ: packetPublish, flags: 0x02, body: body})
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if string(msg.Payload) != "on" || qos != 1 || id != 7 {
+		t.Error("message invalid, got:", string(msg.Payload), qos, id)
+	}
+
+	if _, _, _, err := parsePublish(&packet{typ: packetPublish, body: []byte{0x00, 0x05, 'a'}}); !errors.Is(err, errMalformedPacket) {
+		t.Error("error invalid, got:", err, "want:", errMalformedPacket)
+	}
+}
+
+func TestFieldTooLarge(t *testing.T) {
+	long := strings.Repeat("a", maxFieldLength+1)
+	if _, err := publishPacket(&Message{Topic: long}); err == nil {
+		t.Error("error expected for topic of", len(long), "bytes")
+	}
+	if _, err := publishPacket(&Message{Topic: long[:maxFieldLength]}); err != nil {
+		t.Error("error unexpectedly returned: ", err)
+	}
+
+	broker := newTestBroker(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := Dial(ctx, broker.addr(), &ConnectOptions{ClientID: "bridge", Will: &Message{Topic: "a", Payload: []byte(long)}})
+	if err == nil || !strings.Contains(err.Error(), "field too large") {
+		t.Error("error invalid, got:", err, "want: field too large")
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"venstar/hall/info", "venstar/hall/info", true},
+		{"venstar/hall/info", "venstar/hall/sensors", false},
+		{"venstar/+/set/+", "venstar/hall/set/mode", true},
+		{"venstar/+/set/+", "venstar/hall/set", false},
+		{"venstar/+/set/+", "venstar/hall/set/mode/extra", false},
+		{"venstar/#", "venstar", true},
+		{"venstar/#", "venstar/hall/alerts/filter", true},
+		{"#", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	}
+	for _, test := range tests {
+		t.Run(test.filter+" "+test.topic, func(t *testing.T) {
+			if got := matchTopic(test.filter, test.topic); got != test.want {
+				t.Error("match invalid, got:", got, "want:", test.want)
+			}
+		})
+	}
+}
+
+func TestConn(t *testing.T) {
+	broker := newTestBroker(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pub, err := Dial(ctx, broker.addr(), &ConnectOptions{ClientID: "pub"})
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	defer pub.Close()
+	if err := pub.Publish(ctx, &Message{Topic: "venstar/hall/info", Payload: []byte("retained"), Retain: true}); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	broker.waitRetained(t, "venstar/hall/info", "retained")
+
+	sub, err := Dial(ctx, broker.addr(), &ConnectOptions{ClientID: "sub", KeepAlive: time.Second})
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	defer sub.Close()
+	received := make(chan *Message, 10)
+	if err := sub.Subscribe(ctx, "venstar/hall/#", func(msg *Message) { received <- msg }); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if err := pub.Publish(ctx, &Message{Topic: "venstar/hall/set/mode", Payload: []byte("heat")}); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if err := pub.Publish(ctx, &Message{Topic: "venstar/other/set/mode", Payload: []byte("cool")}); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+
+	for _, want := range []string{"retained", "heat"} {
+		select {
+		case msg := <-received:
+			if string(msg.Payload) != want {
+				t.Error("payload invalid, got:", string(msg.Payload), "want:", want)
+			}
+		case <-ctx.Done():
+			t.Fatal("message not received, want:", want)
+		}
+	}
+
+	// Keep alive pings keep the connection open past the keep alive interval.
+	time.Sleep(1500 * time.Millisecond)
+	if err := sub.Err(); err != nil {
+		t.Error("error unexpectedly returned: ", err)
+	}
+
+	sub.Close()
+	<-sub.Done()
+	if err := sub.Publish(ctx, &Message{Topic: "a"}); !errors.Is(err, ErrClosed) {
+		t.Error("error invalid, got:", err, "want:", ErrClosed)
+	}
+}
+
+func TestConnRefused(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.password = "secret"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := Dial(ctx, broker.addr(), &ConnectOptions{ClientID: "bridge", Username: "user", Password: "wrong"})
+	var connErr *ConnectError
+	if !errors.As(err, &connErr) || connErr.Code != 4 {
+		t.Fatal("error invalid, got:", err, "want: code 4")
+	}
+
+	conn, err := Dial(ctx, broker.addr(), &ConnectOptions{ClientID: "bridge", Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	conn.Close()
+}
+
+func TestConnKeepAliveTimeout(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.ignorePings = true
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, broker.addr(), &ConnectOptions{ClientID: "bridge", KeepAlive: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	defer conn.Close()
+	select {
+	case <-conn.Done():
+	case <-ctx.Done():
+		t.Fatal("connection not closed after keep alive")
+	}
+	if err := conn.Err(); !errors.Is(err, ErrClosed) || !strings.Contains(err.Error(), "keep alive") {
+		t.Error("error invalid, got:", err)
+	}
+}
@@ -0,0 +1,245 @@
+package mqttbridge
+
+import (
+	"context"
+	"fmt"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+// haAvailability is a topic reporting whether an entity is online or
+// offline.
+type haAvailability struct {
+	Topic string `json:"topic"`
+}
+
+// haDevice groups the entities of a thermostat in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name,omitempty"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+// haClimate is the discovery config of an MQTT climate entity.
+type haClimate struct {
+	// Name is always null, naming the entity after the device.
+	Name             *string          `json:"name"`
+	UniqueID         string           `json:"unique_id"`
+	Device           haDevice         `json:"device"`
+	Availability     []haAvailability `json:"availability"`
+	AvailabilityMode string           `json:"availability_mode"`
+
+	Modes             []string `json:"modes"`
+	ModeCommandTopic  string   `json:"mode_command_topic"`
+	ModeStateTopic    string   `json:"mode_state_topic"`
+	ModeStateTemplate string   `json:"mode_state_template"`
+
+	FanModes             []string `json:"fan_modes"`
+	FanModeCommandTopic  string   `json:"fan_mode_command_topic"`
+	FanModeStateTopic    string   `json:"fan_mode_state_topic"`
+	FanModeStateTemplate string   `json:"fan_mode_state_template"`
+
+	PresetModes                []string `json:"preset_modes,omitempty"`
+	PresetModeCommandTopic     string   `json:"preset_mode_command_topic,omitempty"`
+	PresetModeStateTopic       string   `json:"preset_mode_state_topic,omitempty"`
+	PresetModeValueTemplate    string   `json:"preset_mode_value_template,omitempty"`
+	ActionTopic                string   `json:"action_topic"`
+	ActionTemplate             string   `json:"action_template"`
+	CurrentTemperatureTopic    string   `json:"current_temperature_topic"`
+	CurrentTemperatureTemplate string   `json:"current_temperature_template"`
+	CurrentHumidityTopic       string   `json:"current_humidity_topic,omitempty"`
+	CurrentHumidityTemplate    string   `json:"current_humidity_template,omitempty"`
+	TemperatureCommandTopic    string   `json:"temperature_command_topic"`
+	TemperatureStateTopic      string   `json:"temperature_state_topic"`
+	TemperatureStateTemplate   string   `json:"temperature_state_template"`
+
+	TemperatureLowCommandTopic  string `json:"temperature_low_command_topic"`
+	TemperatureLowStateTopic    string `json:"temperature_low_state_topic"`
+	TemperatureLowStateTemplate string `json:"temperature_low_state_template"`
+
+	TemperatureHighCommandTopic  string `json:"temperature_high_command_topic"`
+	TemperatureHighStateTopic    string `json:"temperature_high_state_topic"`
+	TemperatureHighStateTemplate string `json:"temperature_high_state_template"`
+
+	MinTemp         float64 `json:"min_temp"`
+	MaxTemp         float64 `json:"max_temp"`
+	TempStep        float64 `json:"temp_step"`
+	Precision       float64 `json:"precision"`
+	TemperatureUnit string  `json:"temperature_unit"`
+}
+
+// haSensor is the discovery config of an MQTT sensor or binary sensor
+// entity.
+type haSensor struct {
+	Name              string           `json:"name"`
+	UniqueID          string           `json:"unique_id"`
+	Device            haDevice         `json:"device"`
+	Availability      []haAvailability `json:"availability"`
+	AvailabilityMode  string           `json:"availability_mode"`
+	StateTopic        string           `json:"state_topic"`
+	ValueTemplate     string           `json:"value_template,omitempty"`
+	DeviceClass       string           `json:"device_class,omitempty"`
+	StateClass        string           `json:"state_class,omitempty"`
+	UnitOfMeasurement string           `json:"unit_of_measurement,omitempty"`
+	PayloadOn         string           `json:"payload_on,omitempty"`
+	PayloadOff        string           `json:"payload_off,omitempty"`
+}
+
+// Templates mapping QueryInfo values to Home Assistant states.
+const (
+	modeStateTemplate        = "{{ {0: 'off', 1: 'heat', 2: 'cool', 3: 'heat_cool'}[value_json.mode] }}"
+	fanModeStateTemplate     = "{{ {0: 'auto', 1: 'on'}[value_json.fan] }}"
+	presetModeValueTemplate  = "{{ 'away' if value_json.away == 1 else 'none' }}"
+	actionTemplate           = "{{ 'off' if value_json.mode == 0 else {1: 'heating', 2: 'cooling'}.get(value_json.state, 'idle') }}"
+	temperatureStateTemplate = "{{ value_json.cooltemp if value_json.mode == 2 else value_json.heattemp }}"
+)
+
+// haModes maps thermostat modes to Home Assistant hvac modes.
+var haModes = []struct {
+	mode thermostat.Mode
+	name string
+}{
+	{thermostat.ModeOff, "off"},
+	{thermostat.ModeHeat, "heat"},
+	{thermostat.ModeCool, "cool"},
+	{thermostat.ModeAuto, "heat_cool"},
+}
+
+func (b *Bridge) discoveryTopic(component, objectID string) string {
+	return b.discoveryPrefix() + "/" + component + "/" + objectID + "/config"
+}
+
+// publishDiscovery publishes the Home Assistant discovery configs for the
+// device's climate entity, sensors and alerts.
+func (b *Bridge) publishDiscovery(ctx context.Context, dev *Device, info *thermostat.QueryInfo, sensors []*thermostat.Sensor, alerts []*thermostat.Alert) error {
+	id := "venstar_" + slug(dev.ID)
+	device := haDevice{
+		Identifiers:  []string{id},
+		Name:         info.Name,
+		Manufacturer: "Venstar",
+	}
+	// The model is only informational, so failing to retrieve it is ignored.
+	api, err := dev.Thermostat.GetAPIInfoContext(ctx)
+	if err == nil {
+		device.Model = api.Model
+		device.SWVersion = api.Firmware
+	}
+	// Entities are only available while both the bridge and the device are.
+	availability := []haAvailability{
+		{Topic: b.AvailabilityTopic()},
+		{Topic: b.topic(dev, "availability")},
+	}
+	infoTopic := b.topic(dev, "info")
+	unit, tempUnit := "°F", "F"
+	if info.TempUnits == thermostat.Celsius {
+		unit, tempUnit = "°C", "C"
+	}
+
+	climate := &haClimate{
+		UniqueID:         id + "_climate",
+		Device:           device,
+		Availability:     availability,
+		AvailabilityMode: "all",
+
+		ModeCommandTopic:  b.topic(dev, "set", "mode"),
+		ModeStateTopic:    infoTopic,
+		ModeStateTemplate: modeStateTemplate,
+
+		FanModes:             []string{"auto", "on"},
+		FanModeCommandTopic:  b.topic(dev, "set", "fan"),
+		FanModeStateTopic:    infoTopic,
+		FanModeStateTemplate: fanModeStateTemplate,
+
+		ActionTopic:                infoTopic,
+		ActionTemplate:             actionTemplate,
+		CurrentTemperatureTopic:    infoTopic,
+		CurrentTemperatureTemplate: "{{ value_json.spacetemp }}",
+		TemperatureCommandTopic:    b.topic(dev, "set", "temperature"),
+		TemperatureStateTopic:      infoTopic,
+		TemperatureStateTemplate:   temperatureStateTemplate,
+
+		TemperatureLowCommandTopic:  b.topic(dev, "set", "heat_temp"),
+		TemperatureLowStateTopic:    infoTopic,
+		TemperatureLowStateTemplate: "{{ value_json.heattemp }}",
+
+		TemperatureHighCommandTopic:  b.topic(dev, "set", "cool_temp"),
+		TemperatureHighStateTopic:    infoTopic,
+		TemperatureHighStateTemplate: "{{ value_json.cooltemp }}",
+
+		MinTemp:         info.HeatTempMin,
+		MaxTemp:         info.CoolTempMax,
+		TempStep:        info.TempUnits.Increment(),
+		Precision:       info.TempUnits.Increment(),
+		TemperatureUnit: tempUnit,
+	}
+	for _, m := range haModes {
+		if info.AvailableModes.Supports(m.mode) {
+			climate.Modes = append(climate.Modes, m.name)
+		}
+	}
+	if api == nil || api.Type != thermostat.TypeCommercial {
+		climate.PresetModes = []string{"away"}
+		climate.PresetModeCommandTopic = b.topic(dev, "set", "away")
+		climate.PresetModeStateTopic = infoTopic
+		climate.PresetModeValueTemplate = presetModeValueTemplate
+	}
+	if info.HumidityEnabled == 1 {
+		climate.CurrentHumidityTopic = infoTopic
+		climate.CurrentHumidityTemplate = "{{ value_json.hum }}"
+	}
+
+	configs := []*Message{
+		retained(b.discoveryTopic("climate", id), mustJSON(climate)),
+	}
+	for _, sensor := range sensors {
+		objectID := id + "_sensor_" + slug(sensor.Name)
+		configs = append(configs, retained(b.discoveryTopic("sensor", objectID), mustJSON(&haSensor{
+			Name:              sensor.Name,
+			UniqueID:          objectID,
+			Device:            device,
+			Availability:      availability,
+			AvailabilityMode:  "all",
+			StateTopic:        b.topic(dev, "sensors", slug(sensor.Name)),
+			DeviceClass:       "temperature",
+			StateClass:        "measurement",
+			UnitOfMeasurement: unit,
+		})))
+	}
+	if info.HumidityEnabled == 1 {
+		objectID := id + "_humidity"
+		configs = append(configs, retained(b.discoveryTopic("sensor", objectID), mustJSON(&haSensor{
+			Name:              "Humidity",
+			UniqueID:          objectID,
+			Device:            device,
+			Availability:      availability,
+			AvailabilityMode:  "all",
+			StateTopic:        infoTopic,
+			ValueTemplate:     "{{ value_json.hum }}",
+			DeviceClass:       "humidity",
+			StateClass:        "measurement",
+			UnitOfMeasurement: "%",
+		})))
+	}
+	for _, alert := range alerts {
+		objectID := id + "_alert_" + slug(alert.Name)
+		configs = append(configs, retained(b.discoveryTopic("binary_sensor", objectID), mustJSON(&haSensor{
+			Name:             alert.Name,
+			UniqueID:         objectID,
+			Device:           device,
+			Availability:     availability,
+			AvailabilityMode: "all",
+			StateTopic:       b.topic(dev, "alerts", slug(alert.Name)),
+			DeviceClass:      "problem",
+			PayloadOn:        "ON",
+			PayloadOff:       "OFF",
+		})))
+	}
+	for _, msg := range configs {
+		if err := b.Client.Publish(ctx, msg); err != nil {
+			return fmt.Errorf("publishing discovery: %w", err)
+		}
+	}
+	return nil
+}
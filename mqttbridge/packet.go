@@ -0,0 +1,206 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	packetConnect    byte = 1
+	packetConnAck    byte = 2
+	packetPublish    byte = 3
+	packetPubAck     byte = 4
+	packetSubscribe  byte = 8
+	packetSubAck     byte = 9
+	packetPingReq    byte = 12
+	packetPingResp   byte = 13
+	packetDisconnect byte = 14
+)
+
+// maxRemainingLength is the largest remaining length which may be encoded.
+const maxRemainingLength = 268435455
+
+// maxFieldLength is the largest string or binary field which may be encoded,
+// as its length is prefixed as a uint16.
+const maxFieldLength = 0xffff
+
+// maxReadLength is the largest remaining length read, bounding the memory
+// used by a packet from the broker. Commands and acknowledgements are small.
+const maxReadLength = 1 << 20
+
+var errMalformedPacket = errors.New("malformed packet")
+
+// packet is a decoded control packet. The body holds the variable header and
+// payload.
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads a single control packet.
+func readPacket(r *bufio.Reader) (*packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var length, shift int
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return nil, fmt.Errorf("%w: remaining length too long", errMalformedPacket)
+		}
+	}
+	if length > maxReadLength {
+		return nil, fmt.Errorf("%w: remaining length %d exceeds %d", errMalformedPacket, length, maxReadLength)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &packet{typ: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// encode returns the packet with its fixed header.
+func (p *packet) encode() ([]byte, error) {
+	length := len(p.body)
+	if length > maxRemainingLength {
+		return nil, fmt.Errorf("packet too large: %d bytes", length)
+	}
+	buf := make([]byte, 0, length+5)
+	buf = append(buf, p.typ<<4|p.flags)
+	for {
+		b := byte(length & 0x7f)
+		length >>= 7
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buf, p.body...), nil
+}
+
+// packetWriter builds a packet body, recording the first field which is too
+// long to be encoded.
+type packetWriter struct {
+	body []byte
+	err  error
+}
+
+func (w *packetWriter) byte(b byte) {
+	w.body = append(w.body, b)
+}
+
+func (w *packetWriter) uint16(v uint16) {
+	w.body = binary.BigEndian.AppendUint16(w.body, v)
+}
+
+func (w *packetWriter) bytes(b []byte) {
+	if w.err != nil {
+		return
+	}
+	if len(b) > maxFieldLength {
+		w.err = fmt.Errorf("field too large: %d bytes", len(b))
+		return
+	}
+	w.uint16(uint16(len(b)))
+	w.body = append(w.body, b...)
+}
+
+func (w *packetWriter) string(s string) {
+	w.bytes([]byte(s))
+}
+
+// packetReader consumes the fields of a packet body.
+type packetReader struct {
+	body []byte
+	err  error
+}
+
+func (r *packetReader) uint16() uint16 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.body) < 2 {
+		r.err = errMalformedPacket
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.body)
+	r.body = r.body[2:]
+	return v
+}
+
+func (r *packetReader) bytes() []byte {
+	n := int(r.uint16())
+	if r.err != nil {
+		return nil
+	}
+	if len(r.body) < n {
+		r.err = errMalformedPacket
+		return nil
+	}
+	v := r.body[:n]
+	r.body = r.body[n:]
+	return v
+}
+
+func (r *packetReader) string() string {
+	return string(r.bytes())
+}
+
+// Message is an application message published to or received from a broker.
+type Message struct {
+	Topic   string
+	Payload []byte
+	// Retain requests the broker keep the message, delivering it to future
+	// subscribers of the topic.
+	Retain bool
+}
+
+func publishPacket(msg *Message) (*packet, error) {
+	p := &packet{typ: packetPublish}
+	if msg.Retain {
+		p.flags = 0x01
+	}
+	w := &packetWriter{}
+	w.string(msg.Topic)
+	if w.err != nil {
+		return nil, fmt.Errorf("encoding topic: %w", w.err)
+	}
+	p.body = append(w.body, msg.Payload...)
+	return p, nil
+}
+
+// parsePublish decodes a publish packet, returning the message, the QoS and
+// the packet identifier, which is only set for QoS 1 and 2.
+func parsePublish(p *packet) (*Message, byte, uint16, error) {
+	qos := p.flags >> 1 & 0x03
+	r := &packetReader{body: p.body}
+	msg := &Message{
+		Topic:  r.string(),
+		Retain: p.flags&0x01 != 0,
+	}
+	var id uint16
+	if qos > 0 {
+		id = r.uint16()
+	}
+	if r.err != nil {
+		return nil, 0, 0, fmt.Errorf("decoding publish: %w", r.err)
+	}
+	msg.Payload = r.body
+	return msg, qos, id, nil
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+// Error codes returned in an ErrorResponse.
+const (
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnsupported      = "unsupported"
+	CodePinRejected      = "pin_rejected"
+	CodeTimeout          = "timeout"
+	CodeThermostatError  = "thermostat_error"
+)
+
+// ErrorResponse is the body of every failed request.
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
+
+// Error describes why a request failed.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields lists each field which failed validation.
+	Fields []*FieldError `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// FieldError is a request field which failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func invalidRequest(msg string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: msg}
+}
+
+// newError converts errors returned by the thermostat library into an Error.
+func newError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	status, code := errorStatus(err)
+	e = &Error{Status: status, Code: code, Message: err.Error()}
+	var verrs thermostat.ValidationErrors
+	var verr *thermostat.ValidationError
+	// Validation messages describe the fields, omitting the thermostat
+	// request details.
+	switch {
+	case errors.As(err, &verrs):
+		e.Message = verrs.Error()
+		for _, v := range verrs {
+			e.Fields = append(e.Fields, &FieldError{Field: v.Field, Message: v.Message})
+		}
+	case errors.As(err, &verr):
+		e.Message = verr.Error()
+		e.Fields = []*FieldError{{Field: verr.Field, Message: verr.Message}}
+	}
+	return e
+}
+
+// errorStatus returns the status and code of the error returned by the
+// thermostat library.
+func errorStatus(err error) (int, string) {
+	var pinErr *thermostat.PinError
+	switch {
+	case errors.Is(err, thermostat.ErrValidation):
+		return http.StatusUnprocessableEntity, CodeValidationFailed
+	case errors.Is(err, thermostat.ErrUnsupported):
+		return http.StatusUnprocessableEntity, CodeUnsupported
+	case errors.As(err, &pinErr):
+		return http.StatusForbidden, CodePinRejected
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, CodeTimeout
+	}
+	return http.StatusBadGateway, CodeThermostatError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e := newError(err)
+	writeJSON(w, e.Status, &ErrorResponse{Error: e})
+}
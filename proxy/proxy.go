@@ -0,0 +1,407 @@
+// Package proxy serves a JSON api fronting multiple Venstar thermostats.
+//
+// The api exposes:
+//
+//	GET   /devices                  list the devices
+//	GET   /devices/{id}/state       query info, sensors and alerts
+//	PATCH /devices/{id}/controls    update the mode, fan and set points
+//	PATCH /devices/{id}/settings    update the away, schedule, units and
+//	                                humidity settings
+//
+// State is cached for CacheTTL so frequent polling, such as from dashboards,
+// doesn't overload the thermostats. Updates are validated against the
+// thermostat's current state before being sent, and failures are returned as
+// an ErrorResponse.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+// DefaultCacheTTL is how long device state is cached when no TTL is set.
+const DefaultCacheTTL = 5 * time.Second
+
+// fetchTimeout bounds retrieving a device's state, which is shared by every
+// request waiting on it rather than tied to the first.
+const fetchTimeout = 30 * time.Second
+
+// maxBodySize limits the size of update request bodies.
+const maxBodySize = 64 << 10
+
+// Device is a thermostat served by the proxy.
+type Device struct {
+	// ID identifies the device in request paths, such as its inventory
+	// alias.
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+	Thermostat *thermostat.Thermostat `json:"-"`
+}
+
+// State is the response to GET /devices/{id}/state.
+type State struct {
+	ID      string                `json:"id"`
+	Info    *thermostat.QueryInfo `json:"info"`
+	Sensors []*thermostat.Sensor  `json:"sensors"`
+	Alerts  []*thermostat.Alert   `json:"alerts"`
+	// FetchedAt is when the state was retrieved from the thermostat.
+	FetchedAt time.Time `json:"fetched_at"`
+	// Warning is set when an update was applied but the state couldn't be
+	// refreshed afterwards, in which case the last cached state is returned.
+	Warning string `json:"warning,omitempty"`
+}
+
+// ControlsUpdate is the request body of PATCH /devices/{id}/controls. Unset
+// fields keep their current value.
+type ControlsUpdate struct {
+	// Mode is off, heat, cool or auto.
+	Mode *string `json:"mode,omitempty"`
+	// Fan is auto or on.
+	Fan      *string  `json:"fan,omitempty"`
+	HeatTemp *float64 `json:"heat_temp,omitempty"`
+	CoolTemp *float64 `json:"cool_temp,omitempty"`
+}
+
+// SettingsUpdate is the request body of PATCH /devices/{id}/settings. Unset
+// fields keep their current value.
+type SettingsUpdate struct {
+	// TempUnits is fahrenheit or celsius.
+	TempUnits          *string `json:"temp_units,omitempty"`
+	Away               *bool   `json:"away,omitempty"`
+	Schedule           *bool   `json:"schedule,omitempty"`
+	HumidifySetPoint   *int    `json:"humidify_setpoint,omitempty"`
+	DehumidifySetPoint *int    `json:"dehumidify_setpoint,omitempty"`
+}
+
+// Server serves the proxy api for its devices.
+type Server struct {
+	Devices []*Device
+	// CacheTTL is how long device state is cached. Defaults to
+	// DefaultCacheTTL, a negative value disables caching.
+	CacheTTL time.Duration
+
+	once  sync.Once
+	mux   *http.ServeMux
+	mu    sync.Mutex
+	cache map[string]*cachedState
+}
+
+// New creates a Server for the devices.
+func New(devices ...*Device) *Server {
+	return &Server{Devices: devices}
+}
+
+// ServeHTTP handles the api requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(s.routes)
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) routes() {
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /devices", s.handleDevices)
+	s.mux.HandleFunc("GET /devices/{id}/state", s.handleState)
+	s.mux.HandleFunc("PATCH /devices/{id}/controls", s.handleControls)
+	s.mux.HandleFunc("PATCH /devices/{id}/settings", s.handleSettings)
+
+	// Patterns without a method only match when the method is not allowed.
+	for _, path := range []string{"/devices", "/devices/{id}/state", "/devices/{id}/controls", "/devices/{id}/settings"} {
+		s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, &Error{Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed, Message: "method " + r.Method + " not allowed"})
+		})
+	}
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: "path " + r.URL.Path + " not found"})
+	})
+}
+
+func (s *Server) device(r *http.Request) (*Device, error) {
+	id := r.PathValue("id")
+	for _, dev := range s.Devices {
+		if dev.ID == id {
+			return dev, nil
+		}
+	}
+	return nil, &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: fmt.Sprintf("device %q not found", id)}
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	devices := s.Devices
+	if devices == nil {
+		devices = []*Device{}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Devices []*Device `json:"devices"`
+	}{devices})
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	dev, err := s.device(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	state, err := s.state(r.Context(), dev, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (s *Server) handleControls(w http.ResponseWriter, r *http.Request) {
+	dev, err := s.device(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var update ControlsUpdate
+	if err := decodeBody(w, r, &update); err != nil {
+		writeError(w, err)
+		return
+	}
+	apply, err := update.apply()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := dev.Thermostat.ModifyControls(r.Context(), apply); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.respondUpdated(w, r, dev)
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	dev, err := s.device(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var update SettingsUpdate
+	if err := decodeBody(w, r, &update); err != nil {
+		writeError(w, err)
+		return
+	}
+	// Settings are validated against the current state, not the cache.
+	info, err := dev.Thermostat.GetQueryInfoContext(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sr := thermostat.NewSettingsRequestFor(info)
+	if err := update.apply(sr); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := dev.Thermostat.UpdateSettingsContext(r.Context(), sr); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.respondUpdated(w, r, dev)
+}
+
+// respondUpdated responds with the refreshed state after an update. The
+// update has already been applied, so failing to refresh the state responds
+// with the last cached state and a warning rather than an error.
+func (s *Server) respondUpdated(w http.ResponseWriter, r *http.Request, dev *Device) {
+	state, err := s.state(r.Context(), dev, true)
+	if err != nil {
+		state = s.lastState(dev)
+		state.Warning = "update applied, refreshing state failed: " + err.Error()
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// apply returns the function applying the update to a ControlRequest.
+func (u *ControlsUpdate) apply() (func(*thermostat.ControlRequest), error) {
+	if u.Mode == nil && u.Fan == nil && u.HeatTemp == nil && u.CoolTemp == nil {
+		return nil, invalidRequest("no controls provided")
+	}
+	mode := -1
+	if u.Mode != nil {
+		switch *u.Mode {
+		case "off":
+			mode = int(thermostat.ModeOff)
+		case "heat":
+			mode = int(thermostat.ModeHeat)
+		case "cool":
+			mode = int(thermostat.ModeCool)
+		case "auto":
+			mode = int(thermostat.ModeAuto)
+		default:
+			return nil, invalidRequest(fmt.Sprintf("invalid mode %q, must be off, heat, cool or auto", *u.Mode))
+		}
+	}
+	fan := -1
+	if u.Fan != nil {
+		switch *u.Fan {
+		case "auto":
+			fan = 0
+		case "on":
+			fan = 1
+		default:
+			return nil, invalidRequest(fmt.Sprintf("invalid fan %q, must be auto or on", *u.Fan))
+		}
+	}
+	return func(cr *thermostat.ControlRequest) {
+		if mode != -1 {
+			cr.SetMode(mode)
+		}
+		if fan != -1 {
+			cr.SetFan(fan)
+		}
+		if u.HeatTemp != nil {
+			cr.SetHeatTemp(*u.HeatTemp)
+		}
+		if u.CoolTemp != nil {
+			cr.SetCoolTemp(*u.CoolTemp)
+		}
+	}, nil
+}
+
+// apply sets the update fields on the SettingsRequest.
+func (u *SettingsUpdate) apply(sr *thermostat.SettingsRequest) error {
+	if u.TempUnits == nil && u.Away == nil && u.Schedule == nil && u.HumidifySetPoint == nil && u.DehumidifySetPoint == nil {
+		return invalidRequest("no settings provided")
+	}
+	if u.TempUnits != nil {
+		switch *u.TempUnits {
+		case "fahrenheit":
+			sr.Fahrenheit()
+		case "celsius":
+			sr.Celsius()
+		default:
+			return invalidRequest(fmt.Sprintf("invalid temp_units %q, must be fahrenheit or celsius", *u.TempUnits))
+		}
+	}
+	if u.Away != nil {
+		sr.SetAway(*u.Away)
+	}
+	if u.Schedule != nil {
+		if *u.Schedule {
+			sr.ScheduleOn()
+		} else {
+			sr.ScheduleOff()
+		}
+	}
+	if u.HumidifySetPoint != nil {
+		sr.SetHumidifySetPoint(*u.HumidifySetPoint)
+	}
+	if u.DehumidifySetPoint != nil {
+		sr.SetDehumidifySetPoint(*u.DehumidifySetPoint)
+	}
+	return nil
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return invalidRequest("decoding body: " + err.Error())
+	}
+	if dec.More() {
+		return invalidRequest("decoding body: unexpected data after json object")
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// state returns the cached state of the device, retrieving it when the cache
+// is empty, expired or refresh is set. Requests waiting on the cache share the
+// retrieval, so it isn't canceled with ctx.
+func (s *Server) state(ctx context.Context, dev *Device, refresh bool) (*State, error) {
+	c := s.cachedState(dev)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !refresh && c.state != nil && time.Since(c.state.FetchedAt) < s.cacheTTL() {
+		return c.state, nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+	defer cancel()
+	state, err := fetchState(ctx, dev)
+	if err != nil {
+		return nil, err
+	}
+	c.state = state
+	return state, nil
+}
+
+// lastState returns a copy of the last state retrieved from the device,
+// regardless of its age, or a state holding only the device ID if it has
+// never been retrieved.
+func (s *Server) lastState(dev *Device) *State {
+	c := s.cachedState(dev)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == nil {
+		return &State{
+			ID:      dev.ID,
+			Sensors: []*thermostat.Sensor{},
+			Alerts:  []*thermostat.Alert{},
+		}
+	}
+	state := *c.state
+	return &state
+}
+
+func (s *Server) cacheTTL() time.Duration {
+	if s.CacheTTL == 0 {
+		return DefaultCacheTTL
+	}
+	return s.CacheTTL
+}
+
+// cachedState holds the last state retrieved from a device. Its mutex is held
+// while retrieving the state, so concurrent requests share one retrieval.
+type cachedState struct {
+	mu    sync.Mutex
+	state *State
+}
+
+func (s *Server) cachedState(dev *Device) *cachedState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache == nil {
+		s.cache = make(map[string]*cachedState)
+	}
+	c := s.cache[dev.ID]
+	if c == nil {
+		c = &cachedState{}
+		s.cache[dev.ID] = c
+	}
+	return c
+}
+
+func fetchState(ctx context.Context, dev *Device) (*State, error) {
+	snap, err := dev.Thermostat.SnapshotSections(ctx, thermostat.SectionQueryInfo, thermostat.SectionSensors, thermostat.SectionAlerts)
+	if err != nil {
+		return nil, err
+	}
+	state := &State{
+		ID:        dev.ID,
+		Info:      snap.QueryInfo,
+		Sensors:   snap.Sensors,
+		Alerts:    snap.Alerts,
+		FetchedAt: snap.FetchedAt,
+	}
+	if state.Sensors == nil {
+		state.Sensors = []*thermostat.Sensor{}
+	}
+	if state.Alerts == nil {
+		state.Alerts = []*thermostat.Alert{}
+	}
+	return state, nil
+}
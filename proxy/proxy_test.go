@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mrm.dev/venstar/thermostat"
+	"go.mrm.dev/venstar/thermostat/thermostattest"
+)
+
+// fakeInfo is the query info served by the stand-in thermostats.
+var fakeInfo = thermostat.QueryInfo{
+	Name:          "Hallway",
+	Mode:          thermostat.ModeHeat,
+	SpaceTemp:     68,
+	HeatTemp:      68,
+	CoolTemp:      74,
+	HeatTempMin:   35,
+	HeatTempMax:   90,
+	CoolTempMin:   35,
+	CoolTempMax:   99,
+	SetPointDelta: 4,
+}
+
+func request(t *testing.T, s *Server, method, path, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Error("Content-Type invalid, got:", got, "want: application/json")
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	return rec, resp
+}
+
+// errorCode returns the code of an ErrorResponse.
+func errorCode(resp map[string]interface{}) interface{} {
+	e, _ := resp["error"].(map[string]interface{})
+	return e["code"]
+}
+
+func TestServerDevices(t *testing.T) {
+	s := New(&Device{ID: "hall", Name: "Hallway", Tags: []string{"upstairs"}}, &Device{ID: "basement"})
+	rec, resp := request(t, s, "GET", "/devices", "")
+	if rec.Code != http.StatusOK {
+		t.Fatal("status invalid, got:", rec.Code, "want:", http.StatusOK)
+	}
+	want := `{"devices":[{"id":"hall","name":"Hallway","tags":["upstairs"]},{"id":"basement"}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Error("body invalid, got:", got, "want:", want)
+	}
+	if resp["devices"] == nil {
+		t.Error("devices missing")
+	}
+}
+
+func TestServerState(t *testing.T) {
+	fake := thermostattest.NewServer(t, fakeInfo)
+	s := New(&Device{ID: "hall", Thermostat: fake.Thermostat()})
+
+	rec, resp := request(t, s, "GET", "/devices/hall/state", "")
+	if rec.Code != http.StatusOK {
+		t.Fatal("status invalid, got:", rec.Code, "want:", http.StatusOK)
+	}
+	info, _ := resp["info"].(map[string]interface{})
+	if resp["id"] != "hall" || info["name"] != "Hallway" {
+		t.Error("state invalid, got:", rec.Body.String())
+	}
+	if sensors, _ := resp["sensors"].([]interface{}); len(sensors) != 2 {
+		t.Error("sensors invalid, got:", resp["sensors"])
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		request(t, s, "GET", "/devices/hall/state", "")
+		if got := fake.Requests("/query/info"); got != 1 {
+			t.Error("queries invalid, got:", got, "want:", 1)
+		}
+	})
+	t.Run("expired", func(t *testing.T) {
+		s.CacheTTL = time.Nanosecond
+		request(t, s, "GET", "/devices/hall/state", "")
+		if got := fake.Requests("/query/info"); got != 2 {
+			t.Error("queries invalid, got:", got, "want:", 2)
+		}
+	})
+	t.Run("not canceled with request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := s.state(ctx, s.Devices[0], true); err != nil {
+			t.Error("error unexpectedly returned: ", err)
+		}
+	})
+}
+
+func TestServerControls(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		want   url.Values
+	}{
+		{"mode and set point", `{"mode": "cool", "cool_temp": 70}`, http.StatusOK, "",
+			url.Values{"mode": {"2"}, "fan": {"0"}, "heattemp": {"66"}, "cooltemp": {"70"}}},
+		{"fan only", `{"fan": "on"}`, http.StatusOK, "",
+			url.Values{"mode": {"1"}, "fan": {"1"}, "heattemp": {"68"}, "cooltemp": {"74"}}},
+		{"out of range", `{"heat_temp": 20}`, http.StatusUnprocessableEntity, CodeValidationFailed, nil},
+		{"invalid mode", `{"mode": "dry"}`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"unknown field", `{"mode": "heat", "speed": 3}`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"empty", `{}`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"malformed", `{"mode":`, http.StatusBadRequest, CodeInvalidRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := thermostattest.NewServer(t, fakeInfo)
+			s := New(&Device{ID: "hall", Thermostat: fake.Thermostat()})
+			rec, resp := request(t, s, "PATCH", "/devices/hall/controls", test.body)
+			if rec.Code != test.status {
+				t.Fatal("status invalid, got:", rec.Code, "want:", test.status, rec.Body.String())
+			}
+			if test.code != "" {
+				if got := errorCode(resp); got != test.code {
+					t.Error("code invalid, got:", got, "want:", test.code)
+				}
+				if fake.LastUpdate() != nil {
+					t.Error("update unexpectedly sent, got:", fake.LastUpdate())
+				}
+				return
+			}
+			if got := fake.LastUpdate().Encode(); got != test.want.Encode() {
+				t.Error("update invalid, got:", got, "want:", test.want.Encode())
+			}
+			if resp["id"] != "hall" || resp["info"] == nil {
+				t.Error("state invalid, got:", rec.Body.String())
+			}
+		})
+	}
+	t.Run("validation fields", func(t *testing.T) {
+		fake := thermostattest.NewServer(t, fakeInfo)
+		s := New(&Device{ID: "hall", Thermostat: fake.Thermostat()})
+		_, resp := request(t, s, "PATCH", "/devices/hall/controls", `{"heat_temp": 20.5, "cool_temp": 120}`)
+		e, _ := resp["error"].(map[string]interface{})
+		fields, _ := e["fields"].([]interface{})
+		if len(fields) < 2 {
+			t.Fatal("fields invalid, got:", e["fields"])
+		}
+		if field, _ := fields[0].(map[string]interface{}); field["field"] != "HeatTemp" {
+			t.Error("field invalid, got:", field)
+		}
+		want := "HeatTemp 20.5 must be in 1 degree increments in fahrenheit; HeatTemp 20.5 must be between 35 and 90; CoolTemp 120 must be between 35 and 99"
+		if e["message"] != want {
+			t.Error("message invalid, got:", e["message"], "want:", want)
+		}
+	})
+	t.Run("refreshes cached state", func(t *testing.T) {
+		fake := thermostattest.NewServer(t, fakeInfo)
+		s := New(&Device{ID: "hall", Thermostat: fake.Thermostat()})
+		request(t, s, "GET", "/devices/hall/state", "")
+		request(t, s, "PATCH", "/devices/hall/controls", `{"heat_temp": 70}`)
+		_, resp := request(t, s, "GET", "/devices/hall/state", "")
+		if info, _ := resp["info"].(map[string]interface{}); info["heattemp"] != 70.0 {
+			t.Error("heattemp invalid, got:", info["heattemp"], "want:", 70)
+		}
+	})
+	t.Run("refresh failure returns cached state", func(t *testing.T) {
+		fake := thermostattest.NewServer(t, fakeInfo)
+		s := New(&Device{ID: "hall", Thermostat: fake.Thermostat()})
+		request(t, s, "GET", "/devices/hall/state", "")
+		fake.SetBody("/query/sensors", `not json`)
+		rec, resp := request(t, s, "PATCH", "/devices/hall/controls", `{"heat_temp": 70}`)
+		if rec.Code != http.StatusOK {
+			t.Fatal("status invalid, got:", rec.Code, "want:", http.StatusOK, rec.Body.String())
+		}
+		if got := fake.LastUpdate().Get("heattemp"); got != "70" {
+			t.Error("update invalid, got:", got, "want: 70")
+		}
+		if warning, _ := resp["warning"].(string); !strings.HasPrefix(warning, "update applied, refreshing state failed: ") {
+			t.Error("warning invalid, got:", resp["warning"])
+		}
+		if info, _ := resp["info"].(map[string]interface{}); info["heattemp"] != 68.0 {
+			t.Error("heattemp invalid, got:", info["heattemp"], "want:", 68)
+		}
+		_, resp = request(t, s, "GET", "/devices/hall/state", "")
+		if resp["warning"] != nil {
+			t.Error("warning cached, got:", resp["warning"])
+		}
+	})
+}
+
+func TestServerSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		want   url.Values
+	}{
+		{"away", `{"away": true}`, http.StatusOK, "", url.Values{"away": {"1"}}},
+		{"units and schedule", `{"temp_units": "celsius", "schedule": false}`, http.StatusOK, "", url.Values{"tempunits": {"1"}, "schedule": {"0"}}},
+		{"humidity disabled", `{"humidify_setpoint": 40}`, http.StatusUnprocessableEntity, CodeValidationFailed, nil},
+		{"invalid units", `{"temp_units": "kelvin"}`, http.StatusBadRequest, CodeInvalidRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := thermostattest.NewServer(t, fakeInfo)
+			s := New(&Device{ID: "hall", Thermostat: fake.Thermostat()})
+			rec, resp := request(t, s, "PATCH", "/devices/hall/settings", test.body)
+			if rec.Code != test.status {
+				t.Fatal("status invalid, got:", rec.Code, "want:", test.status, rec.Body.String())
+			}
+			if test.code != "" {
+				if got := errorCode(resp); got != test.code {
+					t.Error("code invalid, got:", got, "want:", test.code)
+				}
+				return
+			}
+			if got := fake.LastUpdate().Encode(); got != test.want.Encode() {
+				t.Error("update invalid, got:", got, "want:", test.want.Encode())
+			}
+		})
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(down.Close)
+	s := New(&Device{ID: "hall", Thermostat: thermostat.New(strings.TrimPrefix(down.URL, "http://"))})
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"unknown device", "GET", "/devices/garage/state", http.StatusNotFound, CodeNotFound},
+		{"unknown path", "GET", "/thermostats", http.StatusNotFound, CodeNotFound},
+		{"method not allowed", "DELETE", "/devices/hall/state", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{"unreachable thermostat", "GET", "/devices/hall/state", http.StatusBadGateway, CodeThermostatError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec, resp := request(t, s, test.method, test.path, "")
+			if rec.Code != test.status {
+				t.Error("status invalid, got:", rec.Code, "want:", test.status)
+			}
+			if got := errorCode(resp); got != test.code {
+				t.Error("code invalid, got:", got, "want:", test.code)
+			}
+		})
+	}
+}
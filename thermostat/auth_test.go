@@ -0,0 +1,358 @@
+package thermostat
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAuthServer is a stand-in for an https thermostat requiring Basic or
+// Digest authentication.
+type fakeAuthServer struct {
+	*httptest.Server
+	scheme    string
+	algorithm string
+	username  string
+	password  string
+
+	mu         sync.Mutex
+	nonce      string
+	nonces     int
+	challenges int
+	lastNC     string
+	bodies     []string
+	// expireNonces is the number of otherwise valid digest answers which are
+	// rejected as stale after rotating the nonce.
+	expireNonces int
+}
+
+func newFakeAuthServer(t *testing.T, scheme, algorithm string) *fakeAuthServer {
+	t.Helper()
+	s := &fakeAuthServer{
+		scheme:    scheme,
+		algorithm: algorithm,
+		username:  "admin",
+		password:  "secret",
+	}
+	s.rotateNonce()
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.handle))
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeAuthServer) rotateNonce() {
+	s.nonces++
+	s.nonce = fmt.Sprintf("nonce-%d", s.nonces)
+}
+
+func (s *fakeAuthServer) host() string {
+	return strings.TrimPrefix(s.URL, "https://")
+}
+
+func (s *fakeAuthServer) fingerprint() string {
+	return CertificateFingerprint(s.Certificate())
+}
+
+func (s *fakeAuthServer) challenge(w http.ResponseWriter, stale bool) {
+	s.challenges++
+	if s.scheme == "basic" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="venstar"`)
+	} else {
+		header := fmt.Sprintf(`Digest realm="venstar", qop="auth", nonce=%q, opaque="opaque-value"`, s.nonce)
+		if s.algorithm != "" {
+			header += ", algorithm=" + s.algorithm
+		}
+		if stale {
+			header += ", stale=true"
+		}
+		w.Header().Add("WWW-Authenticate", `Basic realm="venstar"`)
+		w.Header().Add("WWW-Authenticate", header)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (s *fakeAuthServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		s.challenge(w, false)
+		return
+	}
+	if s.scheme == "basic" {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != s.username || password != s.password {
+			s.challenge(w, false)
+			return
+		}
+	} else {
+		if !strings.HasPrefix(authorization, "Digest ") {
+			s.challenge(w, false)
+			return
+		}
+		params := parseAuthParams(strings.TrimPrefix(authorization, "Digest "))
+		if params["nonce"] != s.nonce {
+			s.challenge(w, true)
+			return
+		}
+		if params["nc"] <= s.lastNC {
+			s.challenge(w, false)
+			return
+		}
+		if params["response"] != s.expectedResponse(r.Method, params) {
+			s.challenge(w, false)
+			return
+		}
+		if s.expireNonces > 0 {
+			s.expireNonces--
+			s.rotateNonce()
+			s.lastNC = ""
+			s.challenge(w, true)
+			return
+		}
+		s.lastNC = params["nc"]
+	}
+	s.bodies = append(s.bodies, string(body))
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == "POST" {
+		io.WriteString(w, `{"success": true}`)
+		return
+	}
+	io.WriteString(w, `{"api_ver": 7, "type": "residential"}`)
+}
+
+func (s *fakeAuthServer) expectedResponse(method string, params map[string]string) string {
+	h := func(v string) string {
+		if s.algorithm == "SHA-256" {
+			sum := sha256.Sum256([]byte(v))
+			return hex.EncodeToString(sum[:])
+		}
+		sum := md5.Sum([]byte(v))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := h(s.username + ":venstar:" + s.password)
+	ha2 := h(method + ":" + params["uri"])
+	return h(strings.Join([]string{ha1, s.nonce, params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+}
+
+func TestAuthDigest(t *testing.T) {
+	for _, algorithm := range []string{"", "MD5", "SHA-256"} {
+		t.Run("algorithm "+algorithm, func(t *testing.T) {
+			server := newFakeAuthServer(t, "digest", algorithm)
+			tstat := New(server.host(),
+				WithScheme("https"),
+				WithCertificateFingerprint(server.fingerprint()),
+				WithCredentials("admin", "secret"),
+			)
+			for i := 0; i < 3; i++ {
+				info, err := tstat.GetAPIInfo()
+				if err != nil {
+					t.Fatal("error unexpected, got:", err)
+				}
+				if info.Version != 7 {
+					t.Error("Version incorrect, got:", info.Version, "want: 7")
+				}
+			}
+			if server.challenges != 1 {
+				t.Error("challenges, got:", server.challenges, "want: 1 (nonce reused)")
+			}
+			if server.lastNC != "00000003" {
+				t.Error("nonce count, got:", server.lastNC, "want: 00000003")
+			}
+		})
+	}
+}
+
+func TestAuthDigestRechallenge(t *testing.T) {
+	server := newFakeAuthServer(t, "digest", "")
+	tstat := New(server.host(),
+		WithScheme("https"),
+		WithCertificateFingerprint(server.fingerprint()),
+		WithCredentials("admin", "secret"),
+	)
+	if _, err := tstat.GetAPIInfo(); err != nil {
+		t.Fatal("error unexpected, got:", err)
+	}
+	server.mu.Lock()
+	server.rotateNonce()
+	server.lastNC = ""
+	server.mu.Unlock()
+
+	if err := tstat.UpdateControls(NewControlRequest().FanOn()); err != nil {
+		t.Fatal("error unexpected after nonce rotation, got:", err)
+	}
+	if server.challenges != 2 {
+		t.Error("challenges, got:", server.challenges, "want: 2")
+	}
+	want := "fan=1"
+	if got := server.bodies[len(server.bodies)-1]; got != want {
+		t.Error("body resent incorrectly, got:", got, "want:", want)
+	}
+}
+
+func TestAuthDigestStale(t *testing.T) {
+	tests := []struct {
+		name           string
+		expireNonces   int
+		wantErr        bool
+		wantChallenges int
+	}{
+		{"stale not counted as failed", 2, false, 3},
+		{"stale limited", 10, true, 1 + maxStaleChallenges + 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeAuthServer(t, "digest", "")
+			server.expireNonces = test.expireNonces
+			tstat := New(server.host(),
+				WithScheme("https"),
+				WithCertificateFingerprint(server.fingerprint()),
+				WithCredentials("admin", "secret"),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+			)
+			_, err := tstat.GetAPIInfo()
+			if test.wantErr && err == nil {
+				t.Error("error expected but no error returned")
+			}
+			if !test.wantErr && err != nil {
+				t.Error("error unexpected, got:", err)
+			}
+			if server.challenges != test.wantChallenges {
+				t.Error("challenges, got:", server.challenges, "want:", test.wantChallenges)
+			}
+		})
+	}
+}
+
+func TestAuthBasic(t *testing.T) {
+	server := newFakeAuthServer(t, "basic", "")
+	tstat := New(server.host(),
+		WithScheme("https"),
+		WithCertificateFingerprint(server.fingerprint()),
+		WithCredentials("admin", "secret"),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := tstat.GetAPIInfo(); err != nil {
+			t.Fatal("error unexpected, got:", err)
+		}
+	}
+	if server.challenges != 1 {
+		t.Error("challenges, got:", server.challenges, "want: 1")
+	}
+}
+
+func TestAuthInvalidCredentials(t *testing.T) {
+	for _, scheme := range []string{"basic", "digest"} {
+		t.Run(scheme, func(t *testing.T) {
+			server := newFakeAuthServer(t, scheme, "")
+			tstat := New(server.host(),
+				WithScheme("https"),
+				WithCertificateFingerprint(server.fingerprint()),
+				WithCredentials("admin", "wrong"),
+			)
+			if _, err := tstat.GetAPIInfo(); err == nil {
+				t.Fatal("error expected but no error returned")
+			}
+			if server.challenges != 2 {
+				t.Error("challenges, got:", server.challenges, "want: 2")
+			}
+		})
+	}
+}
+
+func TestCertificateFingerprintPinning(t *testing.T) {
+	server := newFakeAuthServer(t, "basic", "")
+	t.Run("colon separated upper case accepted", func(t *testing.T) {
+		fp := strings.ToUpper(server.fingerprint())
+		var parts []string
+		for i := 0; i < len(fp); i += 2 {
+			parts = append(parts, fp[i:i+2])
+		}
+		tstat := New(server.host(),
+			WithScheme("https"),
+			WithCertificateFingerprint(strings.Join(parts, ":")),
+			WithCredentials("admin", "secret"),
+		)
+		if _, err := tstat.GetAPIInfo(); err != nil {
+			t.Fatal("error unexpected, got:", err)
+		}
+	})
+	t.Run("mismatch rejected", func(t *testing.T) {
+		tstat := New(server.host(),
+			WithScheme("https"),
+			WithCertificateFingerprint(strings.Repeat("00", 32)),
+			WithCredentials("admin", "secret"),
+		)
+		_, err := tstat.GetAPIInfo()
+		if err == nil {
+			t.Fatal("error expected but no error returned")
+		}
+		if !strings.Contains(err.Error(), "fingerprint mismatch") {
+			t.Error("error invalid, got:", err)
+		}
+	})
+	t.Run("unpinned self-signed rejected", func(t *testing.T) {
+		tstat := New(server.host(), WithScheme("https"))
+		if _, err := tstat.GetAPIInfo(); err == nil {
+			t.Fatal("error expected but no error returned")
+		}
+	})
+}
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    authChallenge
+		expErr  bool
+	}{
+		{"none", nil, authChallenge{}, true},
+		{"unknown scheme", []string{`Bearer realm="x"`}, authChallenge{}, true},
+		{"basic", []string{`Basic realm="venstar"`}, authChallenge{scheme: "basic", realm: "venstar"}, false},
+		{
+			"digest preferred",
+			[]string{`Basic realm="venstar"`, `Digest realm="venstar", nonce="abc", qop="auth,auth-int", algorithm=SHA-256, stale=TRUE, opaque="op"`},
+			authChallenge{scheme: "digest", realm: "venstar", nonce: "abc", qop: "auth", algorithm: "SHA-256", stale: true, opaque: "op"},
+			false,
+		},
+		{"digest without qop", []string{`Digest realm="r", nonce="n"`}, authChallenge{scheme: "digest", realm: "r", nonce: "n"}, false},
+		{"digest unsupported qop", []string{`Digest realm="r", nonce="n", qop="auth-int"`}, authChallenge{}, true},
+		{"escaped quotes", []string{`Basic realm="ven\"star"`}, authChallenge{scheme: "basic", realm: `ven"star`}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseChallenge(test.headers)
+			if test.expErr {
+				if err == nil {
+					t.Fatal("error expected but no error returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("error unexpected, got:", err)
+			}
+			if *got != test.want {
+				t.Errorf("challenge, got: %+v want: %+v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestDigestUnsupportedAlgorithm(t *testing.T) {
+	ch := &authChallenge{scheme: "digest", algorithm: "SHA-512-256"}
+	if _, err := ch.digest("GET", "/", "u", "p", 1); err == nil {
+		t.Error("error expected but no error returned")
+	}
+}
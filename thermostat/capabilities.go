@@ -0,0 +1,155 @@
+package thermostat
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Thermostat types reported by APIInfo.
+const (
+	TypeResidential = "residential"
+	TypeCommercial  = "commercial"
+)
+
+// Capabilities describes the features supported by a thermostat.
+//
+// Commercial and residential models expose different fields, and the
+// available modes and humidity settings depend on how the thermostat is
+// installed. Capabilities are derived from the APIInfo type and the
+// QueryInfo only, as none of the features depend on the api version. A
+// Thermostat with capabilities set rejects unsupported update requests with
+// ErrUnsupported before sending them.
+type Capabilities struct {
+	// Type is the thermostat type reported by APIInfo, typically residential
+	// or commercial. Older firmware may not report a type.
+	Type string
+	// AvailableModes are the modes the thermostat may be set to.
+	AvailableModes AvailableModes
+	// HumidityEnabled is set when the thermostat controls humidity.
+	HumidityEnabled bool
+}
+
+// NewCapabilities derives the capabilities of a thermostat from its api and
+// query info.
+func NewCapabilities(api *APIInfo, info *QueryInfo) *Capabilities {
+	return &Capabilities{
+		Type:            api.Type,
+		AvailableModes:  info.AvailableModes,
+		HumidityEnabled: info.HumidityEnabled == 1,
+	}
+}
+
+// IsCommercial reports whether the thermostat is a commercial model.
+func (c *Capabilities) IsCommercial() bool {
+	return c.Type == TypeCommercial
+}
+
+// SupportsMode reports whether the thermostat may be set to the mode.
+func (c *Capabilities) SupportsMode(mode Mode) bool {
+	return c.AvailableModes.Supports(mode)
+}
+
+// SupportsHumidity reports whether the humidify and dehumidify set points may
+// be updated.
+func (c *Capabilities) SupportsHumidity() bool {
+	return c.HumidityEnabled
+}
+
+// SupportsAway reports whether the away setting is available. Away is only
+// available on residential models.
+func (c *Capabilities) SupportsAway() bool {
+	return !c.IsCommercial()
+}
+
+// SupportsHoliday reports whether the thermostat observes holidays. Holidays
+// are only available on commercial models.
+func (c *Capabilities) SupportsHoliday() bool {
+	return c.IsCommercial()
+}
+
+// SupportsOverride reports whether the thermostat supports schedule
+// overrides. Overrides are only available on commercial models.
+func (c *Capabilities) SupportsOverride() bool {
+	return c.IsCommercial()
+}
+
+// SupportsForceUnoccupied reports whether the thermostat may be forced
+// unoccupied. Forcing unoccupied is only available on commercial models.
+func (c *Capabilities) SupportsForceUnoccupied() bool {
+	return c.IsCommercial()
+}
+
+// CheckControls returns an error matching ErrUnsupported if the control
+// request uses features the thermostat does not support.
+func (c *Capabilities) CheckControls(cr *ControlRequest) error {
+	if cr.Mode != nil && !c.SupportsMode(Mode(*cr.Mode)) {
+		return fmt.Errorf("%w: mode %s", ErrUnsupported, modeName(Mode(*cr.Mode)))
+	}
+	return nil
+}
+
+// CheckSettings returns an error matching ErrUnsupported if the settings
+// request uses features the thermostat does not support.
+func (c *Capabilities) CheckSettings(sr *SettingsRequest) error {
+	if sr.IsAway != nil && !c.SupportsAway() {
+		return fmt.Errorf("%w: away on %s thermostat", ErrUnsupported, c.Type)
+	}
+	if (sr.HumidifySetPoint != nil || sr.DehumidifySetPoint != nil) && !c.SupportsHumidity() {
+		return fmt.Errorf("%w: humidity set points with humidity disabled", ErrUnsupported)
+	}
+	return nil
+}
+
+func modeName(mode Mode) string {
+	if name := mode.String(); name != "" {
+		return name
+	}
+	return strconv.Itoa(int(mode))
+}
+
+// SetCapabilities sets the capabilities update requests are checked against.
+// A nil value disables the checks.
+func (t *Thermostat) SetCapabilities(c *Capabilities) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.capabilities = c
+}
+
+func (t *Thermostat) getCapabilities() *Capabilities {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.capabilities
+}
+
+// checkControls checks the control request against the capabilities, if set.
+func (t *Thermostat) checkControls(cr *ControlRequest) error {
+	if c := t.getCapabilities(); c != nil {
+		return c.CheckControls(cr)
+	}
+	return nil
+}
+
+// checkSettings checks the settings request against the capabilities, if set.
+func (t *Thermostat) checkSettings(sr *SettingsRequest) error {
+	if c := t.getCapabilities(); c != nil {
+		return c.CheckSettings(sr)
+	}
+	return nil
+}
+
+// DetectCapabilities requests the api and query info from the thermostat,
+// setting and returning the derived capabilities.
+func (t *Thermostat) DetectCapabilities(ctx context.Context) (*Capabilities, error) {
+	api, err := t.GetAPIInfoContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("detecting capabilities: %w", err)
+	}
+	info, err := t.GetQueryInfoContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("detecting capabilities: %w", err)
+	}
+	c := NewCapabilities(api, info)
+	t.SetCapabilities(c)
+	return c, nil
+}
@@ -0,0 +1,181 @@
+package thermostat
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAvailableModesSupports(t *testing.T) {
+	tests := []struct {
+		modes AvailableModes
+		want  map[Mode]bool
+	}{
+		{0, map[Mode]bool{ModeOff: true, ModeHeat: true, ModeCool: true, ModeAuto: true}},
+		{1, map[Mode]bool{ModeOff: true, ModeHeat: true, ModeCool: true, ModeAuto: false}},
+		{2, map[Mode]bool{ModeOff: true, ModeHeat: true, ModeCool: false, ModeAuto: false}},
+		{3, map[Mode]bool{ModeOff: true, ModeHeat: false, ModeCool: true, ModeAuto: false}},
+	}
+	for _, test := range tests {
+		t.Run(test.modes.String(), func(t *testing.T) {
+			for mode, want := range test.want {
+				if got := test.modes.Supports(mode); got != want {
+					t.Error(mode, "supported invalid, got:", got, "want:", want)
+				}
+			}
+			if test.modes.Supports(Mode(4)) {
+				t.Error("unknown mode unexpectedly supported")
+			}
+		})
+	}
+}
+
+func TestNewCapabilities(t *testing.T) {
+	api := &APIInfo{Version: 7, Type: TypeCommercial}
+	info := &QueryInfo{AvailableModes: 2, HumidityEnabled: 1}
+	c := NewCapabilities(api, info)
+	if c.Type != TypeCommercial {
+		t.Errorf("api capabilities invalid, got: %+v", c)
+	}
+	if !c.SupportsMode(ModeHeat) || c.SupportsMode(ModeCool) {
+		t.Error("modes invalid, got:", c.AvailableModes, "want: heat")
+	}
+	if !c.SupportsHumidity() {
+		t.Error("humidity unexpectedly unsupported")
+	}
+}
+
+func TestCapabilitiesTypes(t *testing.T) {
+	tests := []struct {
+		typ        string
+		away       bool
+		commercial bool
+	}{
+		{TypeResidential, true, false},
+		{TypeCommercial, false, true},
+		{"", true, false},
+	}
+	for _, test := range tests {
+		t.Run("type '"+test.typ+"'", func(t *testing.T) {
+			c := &Capabilities{Type: test.typ}
+			if got := c.SupportsAway(); got != test.away {
+				t.Error("away invalid, got:", got, "want:", test.away)
+			}
+			if got := c.SupportsHoliday(); got != test.commercial {
+				t.Error("holiday invalid, got:", got, "want:", test.commercial)
+			}
+			if got := c.SupportsOverride(); got != test.commercial {
+				t.Error("override invalid, got:", got, "want:", test.commercial)
+			}
+			if got := c.SupportsForceUnoccupied(); got != test.commercial {
+				t.Error("force unoccupied invalid, got:", got, "want:", test.commercial)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesCheck(t *testing.T) {
+	residential := &Capabilities{Type: TypeResidential, AvailableModes: 2}
+	commercial := &Capabilities{Type: TypeCommercial, HumidityEnabled: true}
+	tests := []struct {
+		name   string
+		c      *Capabilities
+		check  func(*Capabilities) error
+		expErr string
+	}{
+		{"supported mode", residential, func(c *Capabilities) error {
+			return c.CheckControls(NewControlRequest().Heat(70, 75))
+		}, ""},
+		{"unsupported mode", residential, func(c *Capabilities) error {
+			return c.CheckControls(NewControlRequest().Cool(75, 70))
+		}, "unsupported by thermostat: mode cool"},
+		{"unknown mode", commercial, func(c *Capabilities) error {
+			return c.CheckControls(NewControlRequest().SetMode(7))
+		}, "unsupported by thermostat: mode 7"},
+		{"fan only", residential, func(c *Capabilities) error {
+			return c.CheckControls(NewControlRequest().FanOn())
+		}, ""},
+		{"residential away", residential, func(c *Capabilities) error {
+			return c.CheckSettings(NewSettingsRequest().Away())
+		}, ""},
+		{"commercial away", commercial, func(c *Capabilities) error {
+			return c.CheckSettings(NewSettingsRequest().Away())
+		}, "unsupported by thermostat: away on commercial thermostat"},
+		{"humidity disabled", residential, func(c *Capabilities) error {
+			return c.CheckSettings(NewSettingsRequest().SetHumidifySetPoint(40))
+		}, "unsupported by thermostat: humidity set points with humidity disabled"},
+		{"humidity enabled", commercial, func(c *Capabilities) error {
+			return c.CheckSettings(NewSettingsRequest().SetDehumidifySetPoint(40))
+		}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.check(test.c)
+			if test.expErr == "" {
+				if err != nil {
+					t.Error("error unexpectedly returned: ", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.expErr {
+				t.Error("error invalid, got:", err, "want:", test.expErr)
+			}
+			if !errors.Is(err, ErrUnsupported) {
+				t.Error("error does not match ErrUnsupported, got:", err)
+			}
+		})
+	}
+}
+
+func TestUpdateCapabilities(t *testing.T) {
+	client := &recordingClient{fakeThermostatClient: fakeThermostatClient{body: `{"success": true}`}}
+	tstat := New("127.0.0.1", WithHTTPClient(client), WithCapabilities(&Capabilities{Type: TypeCommercial, AvailableModes: 3}))
+
+	err := tstat.UpdateControls(NewControlRequest().Heat(70, 75))
+	if !errors.Is(err, ErrUnsupported) {
+		t.Error("control error invalid, got:", err, "want:", ErrUnsupported)
+	}
+	err = tstat.UpdateSettings(NewSettingsRequest().Home())
+	if !errors.Is(err, ErrUnsupported) {
+		t.Error("settings error invalid, got:", err, "want:", ErrUnsupported)
+	}
+	if len(client.requests) != 0 {
+		t.Error("unsupported requests unexpectedly sent, got:", len(client.requests))
+	}
+
+	if err := tstat.UpdateControls(NewControlRequest().Cool(75, 70)); err != nil {
+		t.Error("error unexpectedly returned: ", err)
+	}
+
+	tstat.SetCapabilities(nil)
+	if err := tstat.UpdateControls(NewControlRequest().Heat(70, 75)); err != nil {
+		t.Error("error unexpectedly returned: ", err)
+	}
+	if len(client.requests) != 2 {
+		t.Error("requests sent invalid, got:", len(client.requests), "want:", 2)
+	}
+}
+
+func TestDetectCapabilities(t *testing.T) {
+	client := &routeClient{}
+	tstat := New("127.0.0.1", WithHTTPClient(client))
+	c, err := tstat.DetectCapabilities(context.Background())
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if c.Type != TypeCommercial {
+		t.Errorf("capabilities invalid, got: %+v", c)
+	}
+	if tstat.getCapabilities() != c {
+		t.Error("capabilities not set on thermostat")
+	}
+
+	client.fail = map[string]bool{"/query/info": true}
+	tstat = New("127.0.0.1", WithHTTPClient(client), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	if _, err := tstat.DetectCapabilities(context.Background()); err == nil {
+		t.Error("error expected but no error returned")
+	}
+	if tstat.getCapabilities() != nil {
+		t.Error("capabilities unexpectedly set")
+	}
+}
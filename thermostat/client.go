@@ -2,23 +2,34 @@ package thermostat
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 var (
-	defaultTimeout = 5 * time.Second
-	userAgent      = "go.mrm.dev/venstar:0.1"
+	defaultTimeout     = 5 * time.Second
+	defaultMaxInFlight = 1
+	userAgent          = "go.mrm.dev/venstar:0.1"
+)
+
+const (
+	// maxResponseSize limits how much of a response body is read.
+	maxResponseSize = 1 << 20
+	// maxErrorBodySize limits how much of an error response body is captured.
+	maxErrorBodySize = 512
 )
 
-type thermostatClient interface {
+// HTTPClient is the interface used to send requests to the thermostat.
+// *http.Client satisfies this interface.
+type HTTPClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
@@ -27,98 +38,296 @@ type updateObject interface {
 }
 
 // Thermostat manages communication with Venstar API.
+//
+// A Thermostat is safe for concurrent use by multiple goroutines. Requests are
+// queued per Thermostat so that by default only one request is sent to the
+// device at a time, see WithMaxInFlight and WithMinInterval.
 type Thermostat struct {
-	client  thermostatClient
-	baseURL url.URL
-	pin     string
+	client    HTTPClient
+	baseURL   url.URL
+	timeout   time.Duration
+	userAgent string
+
+	mu           sync.RWMutex
+	pin          string
+	capabilities *Capabilities
+
+	retryPolicy  *RetryPolicy
+	verifyPolicy *VerifyPolicy
+
+	dryRun bool
+	onPlan func(*Plan)
+
+	limiter     *limiter
+	maxInFlight int
+	minInterval time.Duration
+
+	username    string
+	password    string
+	fingerprint string
 }
 
 // SetPin sets the unlock pin when device has a pin set.
 func (t *Thermostat) SetPin(pin string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.pin = pin
 }
 
+func (t *Thermostat) getPin() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.pin
+}
+
 func (t *Thermostat) url(parts ...interface{}) string {
 	pathParts := make([]string, len(parts))
 	for _, part := range parts {
 		pathParts = append(pathParts, strings.TrimLeft(fmt.Sprintf("%s", part), "/"))
 	}
 	nurl := t.baseURL
-	nurl.Path = strings.Join(pathParts, "/")
+	nurl.Path = strings.TrimRight(nurl.Path, "/") + strings.Join(pathParts, "/")
 	return nurl.String()
 }
 
-func (t *Thermostat) buildRequest(method, path string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, path, body)
+// endpoint returns the path of the api url, including any base url path
+// prefix. This matches the Endpoint of APIErrors returned by checkStatus.
+func (t *Thermostat) endpoint(path string) string {
+	u, err := url.Parse(t.url(path))
+	if err != nil {
+		return path
+	}
+	return u.Path
+}
+
+// withTimeout applies the configured request timeout to the provided context.
+func (t *Thermostat) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, t.timeout)
+}
+
+func (t *Thermostat) buildRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("User-Agent", userAgent)
+	ua := t.userAgent
+	if ua == "" {
+		ua = userAgent
+	}
+	req.Header.Add("User-Agent", ua)
 	return req, err
 }
 
-func (t *Thermostat) getJSON(path string, data interface{}) (*http.Response, error) {
-	req, err := t.buildRequest("GET", path, nil)
+func (t *Thermostat) getJSON(ctx context.Context, path string, data interface{}) (*http.Response, error) {
+	return t.send(ctx, path, t.retryPolicy.attempts(false), func(ctx context.Context) (*http.Request, error) {
+		req, err := t.buildRequest(ctx, "GET", path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("building %s request: %w", path, err)
+		}
+		return req, nil
+	}, data)
+}
+
+func (t *Thermostat) postJSON(ctx context.Context, path string, update updateObject, data interface{}) (*http.Response, error) {
+	return t.send(ctx, path, t.retryPolicy.attempts(true), func(ctx context.Context) (*http.Request, error) {
+		return t.buildUpdate(ctx, path, update)
+	}, data)
+}
+
+// buildUpdate builds the POST request for the update, including the pin.
+func (t *Thermostat) buildUpdate(ctx context.Context, path string, update updateObject) (*http.Request, error) {
+	req, err := t.buildRequest(ctx, "POST", path, nil)
 	if err != nil {
-		return nil, errors.Wrap(err, "building "+path+" request")
+		return nil, fmt.Errorf("building %s request: %w", path, err)
 	}
-	resp, err := t.client.Do(req)
+	err = update.BuildRequest(req)
 	if err != nil {
-		return resp, errors.Wrap(err, "requesting "+path)
+		return nil, fmt.Errorf("building %s update request: %w", path, err)
 	}
-	err = DecodeBody(resp, data)
-	if err != nil {
-		return resp, errors.Wrap(err, "decoding "+path+" response")
+	if pin := t.getPin(); pin != "" {
+		err = setFormValue(req, "pin", pin)
+		if err != nil {
+			return nil, fmt.Errorf("setting %s pin: %w", path, err)
+		}
+	}
+	return req, nil
+}
+
+// send builds and sends a request, decoding the response into data. Failed
+// attempts are retried according to the retry policy, up to maxAttempts.
+// Errors building the request are never retried.
+func (t *Thermostat) send(ctx context.Context, path string, maxAttempts int, build func(context.Context) (*http.Request, error), data interface{}) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, built, err := t.attempt(ctx, path, build, data)
+		if err == nil || !built || attempt >= maxAttempts || ctx.Err() != nil || !t.retryPolicy.retryable(err) {
+			if err != nil && attempt > 1 {
+				err = &RetryError{Attempts: attempt, Err: err}
+			}
+			return resp, err
+		}
+		if t.retryPolicy.OnRetry != nil {
+			t.retryPolicy.OnRetry(attempt, err)
+		}
+		if serr := sleepContext(ctx, t.retryPolicy.backoff(attempt)); serr != nil {
+			return resp, &RetryError{Attempts: attempt, Err: err}
+		}
 	}
-	return resp, nil
 }
 
-func (t *Thermostat) postJSON(path string, update updateObject, data interface{}) (*http.Response, error) {
-	req, err := t.buildRequest("POST", path, nil)
+// attempt makes a single request once allowed by the limiter, applying the
+// configured timeout. built reports whether the request was built and sent.
+func (t *Thermostat) attempt(ctx context.Context, path string, build func(context.Context) (*http.Request, error), data interface{}) (resp *http.Response, built bool, err error) {
+	release, err := t.limiter.acquire(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "building "+path+" request")
+		return nil, false, fmt.Errorf("waiting to request %s: %w", path, err)
 	}
-	err = update.BuildRequest(req)
+	defer release()
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+	req, err := build(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "building "+path+" update request")
+		return nil, false, err
 	}
+	resp, err = t.doJSON(req, path, data)
+	return resp, true, err
+}
+
+// doJSON sends the request, verifying the response status and content type
+// before decoding the json response body into data.
+func (t *Thermostat) doJSON(req *http.Request, path string, data interface{}) (*http.Response, error) {
 	resp, err := t.client.Do(req)
 	if err != nil {
-		return resp, errors.Wrap(err, "requesting "+path)
+		return resp, fmt.Errorf("requesting %s: %w", path, err)
+	}
+	err = checkStatus(req, resp)
+	if err != nil {
+		return resp, err
+	}
+	err = checkContentType(resp)
+	if err != nil {
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+		return resp, fmt.Errorf("decoding %s response: %w", path, err)
 	}
 	err = DecodeBody(resp, data)
 	if err != nil {
-		return resp, errors.Wrap(err, "decoding "+path+" response")
+		return resp, fmt.Errorf("decoding %s response: %w", path, err)
 	}
 	return resp, nil
 }
 
+// checkStatus returns an APIError including the start of the response body
+// when the thermostat responds with a non 2xx status.
+func checkStatus(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	apiErr := &APIError{
+		Endpoint:   req.URL.Path,
+		StatusCode: resp.StatusCode,
+	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		apiErr.Body = strings.TrimSpace(string(snippet))
+	}
+	return apiErr
+}
+
+// checkContentType verifies the response is json when the thermostat
+// provides a Content-Type header.
+func checkContentType(resp *http.Response) error {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: invalid content type %q", ErrDecode, contentType)
+	}
+	switch {
+	case mediaType == "application/json", mediaType == "text/json", mediaType == "text/plain":
+		return nil
+	case strings.HasSuffix(mediaType, "+json"):
+		return nil
+	}
+	return fmt.Errorf("%w: unexpected content type %q", ErrDecode, contentType)
+}
+
+// setFormValue sets key on the form encoded body of the provided request.
+func setFormValue(req *http.Request, key, value string) error {
+	params := make(url.Values)
+	if req.Body != nil {
+		raw, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		params, err = url.ParseQuery(string(raw))
+		if err != nil {
+			return err
+		}
+	}
+	params.Set(key, value)
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	body := params.Encode()
+	req.Body = io.NopCloser(strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return nil
+}
+
 // GetAPIInfo retreives the general API information from the thermostat.
 func (t *Thermostat) GetAPIInfo() (*APIInfo, error) {
+	return t.GetAPIInfoContext(context.Background())
+}
+
+// GetAPIInfoContext is like GetAPIInfo but uses the provided context for the
+// request.
+func (t *Thermostat) GetAPIInfoContext(ctx context.Context) (*APIInfo, error) {
 	var info APIInfo
-	_, err := t.getJSON(t.url("/"), &info)
+	_, err := t.getJSON(ctx, t.url("/"), &info)
 	if err != nil {
-		return nil, errors.Wrap(err, "processing api info request")
+		return nil, fmt.Errorf("processing api info request: %w", err)
 	}
 	return &info, nil
 }
 
 // GetQueryInfo retreives overall stats from the thermostat.
 func (t *Thermostat) GetQueryInfo() (*QueryInfo, error) {
+	return t.GetQueryInfoContext(context.Background())
+}
+
+// GetQueryInfoContext is like GetQueryInfo but uses the provided context for
+// the request.
+func (t *Thermostat) GetQueryInfoContext(ctx context.Context) (*QueryInfo, error) {
 	var info QueryInfo
-	_, err := t.getJSON(t.url("/query/info"), &info)
+	_, err := t.getJSON(ctx, t.url("/query/info"), &info)
 	if err != nil {
-		return nil, errors.Wrap(err, "processing query info request")
+		return nil, fmt.Errorf("processing query info request: %w", err)
 	}
 	return &info, nil
 }
 
 // GetQuerySensors retreives the sensor readings from the thermostat.
 func (t *Thermostat) GetQuerySensors() ([]*Sensor, error) {
+	return t.GetQuerySensorsContext(context.Background())
+}
+
+// GetQuerySensorsContext is like GetQuerySensors but uses the provided context
+// for the request.
+// The sensor Units are left unset as the response doesn't include them, see
+// Snapshot.
+func (t *Thermostat) GetQuerySensorsContext(ctx context.Context) ([]*Sensor, error) {
 	var info QueryResponse
-	_, err := t.getJSON(t.url("/query/sensors"), &info)
+	_, err := t.getJSON(ctx, t.url("/query/sensors"), &info)
 	if err != nil {
-		return nil, errors.Wrap(err, "processing query sensors request")
+		return nil, fmt.Errorf("processing query sensors request: %w", err)
 	}
 	return info.Sensors, nil
 }
@@ -126,10 +335,16 @@ func (t *Thermostat) GetQuerySensors() ([]*Sensor, error) {
 // GetQueryRuntimes retreives the active system duration for each day.
 // The results for each timestamp is for 24 hours prior.
 func (t *Thermostat) GetQueryRuntimes() ([]*Runtime, error) {
+	return t.GetQueryRuntimesContext(context.Background())
+}
+
+// GetQueryRuntimesContext is like GetQueryRuntimes but uses the provided
+// context for the request.
+func (t *Thermostat) GetQueryRuntimesContext(ctx context.Context) ([]*Runtime, error) {
 	var info QueryResponse
-	_, err := t.getJSON(t.url("/query/runtimes"), &info)
+	_, err := t.getJSON(ctx, t.url("/query/runtimes"), &info)
 	if err != nil {
-		return nil, errors.Wrap(err, "processing query runtime request")
+		return nil, fmt.Errorf("processing query runtime request: %w", err)
 	}
 	return info.Runtimes, nil
 }
@@ -137,10 +352,16 @@ func (t *Thermostat) GetQueryRuntimes() ([]*Runtime, error) {
 // GetQueryAlerts retreives a list of alerts and whether they are triggered
 // or not.
 func (t *Thermostat) GetQueryAlerts() ([]*Alert, error) {
+	return t.GetQueryAlertsContext(context.Background())
+}
+
+// GetQueryAlertsContext is like GetQueryAlerts but uses the provided context
+// for the request.
+func (t *Thermostat) GetQueryAlertsContext(ctx context.Context) ([]*Alert, error) {
 	var info QueryResponse
-	_, err := t.getJSON(t.url("/query/alerts"), &info)
+	_, err := t.getJSON(ctx, t.url("/query/alerts"), &info)
 	if err != nil {
-		return nil, errors.Wrap(err, "processing query alerts request")
+		return nil, fmt.Errorf("processing query alerts request: %w", err)
 	}
 	return info.Alerts, nil
 }
@@ -148,60 +369,114 @@ func (t *Thermostat) GetQueryAlerts() ([]*Alert, error) {
 // UpdateControls submits the provided update request returning an error if the
 // update failed.
 func (t *Thermostat) UpdateControls(cr *ControlRequest) error {
+	return t.UpdateControlsContext(context.Background(), cr)
+}
+
+// UpdateControlsContext is like UpdateControls but uses the provided context
+// for the request.
+func (t *Thermostat) UpdateControlsContext(ctx context.Context, cr *ControlRequest) error {
+	if err := t.checkControls(cr); err != nil {
+		return fmt.Errorf("processing update control request: %w", err)
+	}
+	if t.dryRun {
+		if err := t.dryRunUpdate(ctx, t.url("/control"), cr); err != nil {
+			return fmt.Errorf("processing update control request: %w", err)
+		}
+		return nil
+	}
 	var updateResponse UpdateResponse
-	_, err := t.postJSON(t.url("/control"), cr, &updateResponse)
+	resp, err := t.postJSON(ctx, t.url("/control"), cr, &updateResponse)
 	if err != nil {
-		return errors.Wrap(err, "processing update control request")
+		return fmt.Errorf("processing update control request: %w", err)
 	}
-	if updateResponse.Error {
-		return errors.New("Control Request update error: " + updateResponse.Reason)
+	endpoint := t.endpoint("/control")
+	if err := updateResponse.err(endpoint, resp); err != nil {
+		return err
 	}
-	if !updateResponse.Success {
-		return errors.New("Control Request unknown error")
-	}
-	return nil
+	return t.verifyUpdate(ctx, endpoint, cr.expectedFields())
 }
 
 // UpdateSettings submits the provided update request returning an error if the
 // update failed.
 func (t *Thermostat) UpdateSettings(sr *SettingsRequest) error {
+	return t.UpdateSettingsContext(context.Background(), sr)
+}
+
+// UpdateSettingsContext is like UpdateSettings but uses the provided context
+// for the request.
+func (t *Thermostat) UpdateSettingsContext(ctx context.Context, sr *SettingsRequest) error {
+	if err := t.checkSettings(sr); err != nil {
+		return fmt.Errorf("processing update settings request: %w", err)
+	}
+	if t.dryRun {
+		if err := t.dryRunUpdate(ctx, t.url("/settings"), sr); err != nil {
+			return fmt.Errorf("processing update settings request: %w", err)
+		}
+		return nil
+	}
 	var updateResponse UpdateResponse
-	_, err := t.postJSON(t.url("/settings"), sr, &updateResponse)
+	resp, err := t.postJSON(ctx, t.url("/settings"), sr, &updateResponse)
 	if err != nil {
-		return errors.Wrap(err, "processing update settings request")
-	}
-	if updateResponse.Error {
-		return errors.New("Settings Request update error: " + updateResponse.Reason)
+		return fmt.Errorf("processing update settings request: %w", err)
 	}
-	if !updateResponse.Success {
-		return errors.New("Settings Request unknown error")
+	endpoint := t.endpoint("/settings")
+	if err := updateResponse.err(endpoint, resp); err != nil {
+		return err
 	}
-	return nil
+	return t.verifyUpdate(ctx, endpoint, sr.expectedFields())
 }
 
 // DecodeBody decodes the json http response body into the provided interface.
+// At most maxResponseSize bytes of the body are read.
 func DecodeBody(resp *http.Response, out interface{}) error {
 	if resp.Body != nil {
 		defer resp.Body.Close()
 
 		var buf bytes.Buffer
-		tee := io.TeeReader(resp.Body, &buf)
+		limited := &io.LimitedReader{R: resp.Body, N: maxResponseSize + 1}
+		tee := io.TeeReader(limited, &buf)
 		resp.Body = io.NopCloser(&buf)
 		err := json.NewDecoder(tee).Decode(out)
+		if limited.N <= 0 {
+			return fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, maxResponseSize)
+		}
 		if err != nil {
-			return errors.Wrap(err, "decoding json")
+			return fmt.Errorf("%w: %w", ErrDecode, err)
 		}
 	}
 	return nil
 }
 
-// New creates a new Thermostat instance
-func New(host string) *Thermostat {
-	client := &http.Client{
-		Timeout: defaultTimeout,
+// New creates a new Thermostat instance for the provided host. Options are
+// applied in the order provided.
+func New(host string, opts ...Option) *Thermostat {
+	retryPolicy := DefaultRetryPolicy
+	t := &Thermostat{
+		baseURL:     url.URL{Scheme: "http", Host: host},
+		timeout:     defaultTimeout,
+		userAgent:   userAgent,
+		retryPolicy: &retryPolicy,
+		maxInFlight: defaultMaxInFlight,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.limiter = newLimiter(t.maxInFlight, t.minInterval)
+	if t.client == nil {
+		t.client = t.defaultClient()
 	}
-	return &Thermostat{
-		client:  client,
-		baseURL: url.URL{Scheme: "http", Host: host},
+	if t.username != "" {
+		t.client = newAuthClient(t.client, t.username, t.password)
+	}
+	return t
+}
+
+func (t *Thermostat) defaultClient() *http.Client {
+	client := &http.Client{}
+	if t.fingerprint != "" {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = pinnedTLSConfig(t.fingerprint)
+		client.Transport = transport
 	}
+	return client
 }
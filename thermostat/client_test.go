@@ -1,11 +1,14 @@
 package thermostat
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSetPin(t *testing.T) {
@@ -21,7 +24,7 @@ func TestBuildRequest(t *testing.T) {
 	tstat := &Thermostat{}
 
 	t.Run("invalid request returns error", func(t *testing.T) {
-		_, err := tstat.buildRequest("GET", "://bad", nil)
+		_, err := tstat.buildRequest(context.Background(), "GET", "://bad", nil)
 		if err == nil {
 			t.Error("error expected, but none returned")
 		}
@@ -31,7 +34,7 @@ func TestBuildRequest(t *testing.T) {
 
 	for _, method := range testMethods {
 		t.Run(method+" method is set", func(t *testing.T) {
-			req, err := tstat.buildRequest(method, "http://localhost", nil)
+			req, err := tstat.buildRequest(context.Background(), method, "http://localhost", nil)
 			if err != nil {
 				t.Fatal("returned error when none was expected:", err)
 			}
@@ -44,7 +47,7 @@ func TestBuildRequest(t *testing.T) {
 	wantUserAgent := "go.mrm.dev/venstar:0.1"
 	for _, method := range testMethods {
 		t.Run(method+" User-Agent header is set", func(t *testing.T) {
-			req, err := tstat.buildRequest(method, "http://localhost", nil)
+			req, err := tstat.buildRequest(context.Background(), method, "http://localhost", nil)
 			if err != nil {
 				t.Fatal("returned error when none was expected:", err)
 			}
@@ -57,7 +60,7 @@ func TestBuildRequest(t *testing.T) {
 	}
 
 	t.Run("nil request body stays nil", func(t *testing.T) {
-		req, err := tstat.buildRequest("POST", "http://localhost", nil)
+		req, err := tstat.buildRequest(context.Background(), "POST", "http://localhost", nil)
 		if err != nil {
 			t.Fatal("returned error when none was expected:", err)
 		}
@@ -69,7 +72,7 @@ func TestBuildRequest(t *testing.T) {
 	t.Run("request body stays in tact", func(t *testing.T) {
 		want := "this is test text"
 		body := strings.NewReader(want)
-		req, err := tstat.buildRequest("POST", "http://localhost", body)
+		req, err := tstat.buildRequest(context.Background(), "POST", "http://localhost", body)
 		if err != nil {
 			t.Fatal("returned error when none was expected:", err)
 		}
@@ -86,9 +89,88 @@ func TestBuildRequest(t *testing.T) {
 	})
 }
 
+func TestBuildRequestContext(t *testing.T) {
+	tstat := &Thermostat{}
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	req, err := tstat.buildRequest(ctx, "GET", "http://localhost", nil)
+	if err != nil {
+		t.Fatal("returned error when none was expected:", err)
+	}
+	if req.Context().Value(ctxKey{}) != "value" {
+		t.Error("request context not propagated")
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	tstat := New(strings.TrimPrefix(server.URL, "http://"))
+
+	calls := []struct {
+		name string
+		call func(context.Context) error
+	}{
+		{"GetAPIInfoContext", func(ctx context.Context) error {
+			_, err := tstat.GetAPIInfoContext(ctx)
+			return err
+		}},
+		{"GetQueryInfoContext", func(ctx context.Context) error {
+			_, err := tstat.GetQueryInfoContext(ctx)
+			return err
+		}},
+		{"GetQuerySensorsContext", func(ctx context.Context) error {
+			_, err := tstat.GetQuerySensorsContext(ctx)
+			return err
+		}},
+		{"GetQueryRuntimesContext", func(ctx context.Context) error {
+			_, err := tstat.GetQueryRuntimesContext(ctx)
+			return err
+		}},
+		{"GetQueryAlertsContext", func(ctx context.Context) error {
+			_, err := tstat.GetQueryAlertsContext(ctx)
+			return err
+		}},
+		{"UpdateControlsContext", func(ctx context.Context) error {
+			return tstat.UpdateControlsContext(ctx, NewControlRequest().FanOn())
+		}},
+		{"UpdateSettingsContext", func(ctx context.Context) error {
+			return tstat.UpdateSettingsContext(ctx, NewSettingsRequest().Home())
+		}},
+	}
+	for _, call := range calls {
+		t.Run(call.name+" deadline", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := call.call(ctx)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Error("error invalid, got:", err, "want:", context.DeadlineExceeded)
+			}
+		})
+		t.Run(call.name+" canceled", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := call.call(ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Error("error invalid, got:", err, "want:", context.Canceled)
+			}
+		})
+	}
+}
+
 type fakeThermostatClient struct {
-	body  string
-	error bool
+	body   string
+	error  bool
+	status int
+	header http.Header
 }
 
 func (c *fakeThermostatClient) Do(_ *http.Request) (*http.Response, error) {
@@ -96,8 +178,14 @@ func (c *fakeThermostatClient) Do(_ *http.Request) (*http.Response, error) {
 	if c.body != "" {
 		body = io.NopCloser(strings.NewReader(c.body))
 	}
+	status := c.status
+	if status == 0 {
+		status = http.StatusOK
+	}
 	resp := &http.Response{
-		Body: body,
+		StatusCode: status,
+		Header:     c.header,
+		Body:       body,
 	}
 	var err error
 	if c.error {
@@ -132,7 +220,7 @@ func TestGetJSON(t *testing.T) {
 			}
 
 			var out string
-			_, err := tstat.getJSON(test.url, &out)
+			_, err := tstat.getJSON(context.Background(), test.url, &out)
 
 			if test.expErr != "" && err == nil {
 				t.Fatal("error", test.expErr, "wanted, got nil")
@@ -185,7 +273,7 @@ func TestPostJSON(t *testing.T) {
 			update := &fakeUpdate{test.updateErr}
 
 			var out string
-			_, err := tstat.postJSON(test.url, update, &out)
+			_, err := tstat.postJSON(context.Background(), test.url, update, &out)
 
 			if test.expErr != "" && err == nil {
 				t.Fatal("error", test.expErr, "wanted, got nil")
@@ -197,6 +285,231 @@ func TestPostJSON(t *testing.T) {
 	}
 }
 
+func TestDoJSONResponseChecks(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      *fakeThermostatClient
+		expStatus   int
+		expBody     string
+		expDecode   bool
+		expTooLarge bool
+	}{
+		{
+			name:      "not found",
+			client:    &fakeThermostatClient{status: 404, body: "<html>Not Found</html>", header: http.Header{"Content-Type": {"text/html"}}},
+			expStatus: 404,
+			expBody:   "<html>Not Found</html>",
+		},
+		{
+			name:      "server error",
+			client:    &fakeThermostatClient{status: 500, body: `{"error": true}`},
+			expStatus: 500,
+			expBody:   `{"error": true}`,
+		},
+		{
+			name:      "error body truncated",
+			client:    &fakeThermostatClient{status: 502, body: strings.Repeat("x", maxErrorBodySize*2)},
+			expStatus: 502,
+			expBody:   strings.Repeat("x", maxErrorBodySize),
+		},
+		{
+			name:      "html content type",
+			client:    &fakeThermostatClient{body: `"valid"`, header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}},
+			expDecode: true,
+		},
+		{
+			name:      "invalid content type",
+			client:    &fakeThermostatClient{body: `"valid"`, header: http.Header{"Content-Type": {"/"}}},
+			expDecode: true,
+		},
+		{
+			name:   "json content type",
+			client: &fakeThermostatClient{body: `"valid"`, header: http.Header{"Content-Type": {"application/json; charset=utf-8"}}},
+		},
+		{
+			name:   "plain content type",
+			client: &fakeThermostatClient{body: `"valid"`, header: http.Header{"Content-Type": {"text/plain"}}},
+		},
+		{
+			name:        "oversized response",
+			client:      &fakeThermostatClient{body: `"` + strings.Repeat("x", maxResponseSize) + `"`},
+			expTooLarge: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tstat := &Thermostat{client: test.client}
+			var out string
+			_, err := tstat.getJSON(context.Background(), "http://localhost/query/info", &out)
+			switch {
+			case test.expStatus != 0:
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) {
+					t.Fatal("error type invalid, got:", err, "want: *APIError")
+				}
+				if apiErr.StatusCode != test.expStatus {
+					t.Error("StatusCode invalid, got:", apiErr.StatusCode, "want:", test.expStatus)
+				}
+				if apiErr.Endpoint != "/query/info" {
+					t.Error("Endpoint invalid, got:", apiErr.Endpoint, "want: /query/info")
+				}
+				if apiErr.Body != test.expBody {
+					t.Error("Body invalid, got:", apiErr.Body, "want:", test.expBody)
+				}
+			case test.expDecode:
+				if !errors.Is(err, ErrDecode) {
+					t.Fatal("error invalid, got:", err, "want: ErrDecode")
+				}
+			case test.expTooLarge:
+				if !errors.Is(err, ErrResponseTooLarge) {
+					t.Fatal("error invalid, got:", err, "want: ErrResponseTooLarge")
+				}
+			default:
+				if err != nil {
+					t.Fatal("error unexpected, got:", err)
+				}
+				if out != "valid" {
+					t.Error("out invalid, got:", out, "want: valid")
+				}
+			}
+		})
+	}
+}
+
+func TestSetFormValue(t *testing.T) {
+	t.Run("nil body creates form", func(t *testing.T) {
+		req := &http.Request{Header: make(http.Header)}
+		err := setFormValue(req, "pin", "1597")
+		if err != nil {
+			t.Fatal("returned error when none was expected:", err)
+		}
+		body, _ := io.ReadAll(req.Body)
+		want := "pin=1597"
+		if string(body) != want {
+			t.Error("body got:", string(body), "want:", want)
+		}
+		if req.ContentLength != int64(len(want)) {
+			t.Error("ContentLength got:", req.ContentLength, "want:", len(want))
+		}
+		if ct := req.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+			t.Error("Content-Type got:", ct)
+		}
+	})
+	t.Run("existing values preserved", func(t *testing.T) {
+		req := &http.Request{
+			Header: make(http.Header),
+			Body:   io.NopCloser(strings.NewReader("mode=1")),
+		}
+		err := setFormValue(req, "pin", "1597")
+		if err != nil {
+			t.Fatal("returned error when none was expected:", err)
+		}
+		body, _ := io.ReadAll(req.Body)
+		want := "mode=1&pin=1597"
+		if string(body) != want {
+			t.Error("body got:", string(body), "want:", want)
+		}
+	})
+	t.Run("invalid body returns error", func(t *testing.T) {
+		req := &http.Request{
+			Header: make(http.Header),
+			Body:   io.NopCloser(strings.NewReader("%zz")),
+		}
+		if err := setFormValue(req, "pin", "1597"); err == nil {
+			t.Error("error expected, but none returned")
+		}
+	})
+}
+
+// newPinServer returns a stand-in thermostat which rejects any update which
+// does not provide the expected pin.
+func newPinServer(t *testing.T, pin string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error("parsing form:", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("pin") != pin {
+			io.WriteString(w, `{"error": true, "reason": "Invalid PIN"}`)
+			return
+		}
+		io.WriteString(w, `{"success": true}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPinUpdates(t *testing.T) {
+	server := newPinServer(t, "1597")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	updates := []struct {
+		name   string
+		update func(*Thermostat) error
+	}{
+		{"controls", func(tstat *Thermostat) error {
+			return tstat.UpdateControls(NewControlRequest().FanOn())
+		}},
+		{"settings", func(tstat *Thermostat) error {
+			return tstat.UpdateSettings(NewSettingsRequest().Home())
+		}},
+	}
+	for _, update := range updates {
+		t.Run(update.name+" with pin", func(t *testing.T) {
+			tstat := New(host)
+			tstat.SetPin("1597")
+			if err := update.update(tstat); err != nil {
+				t.Fatal("error unexpected, got:", err.Error(), "want: nil")
+			}
+		})
+		for _, pin := range []string{"", "0000"} {
+			t.Run(update.name+" with pin '"+pin+"'", func(t *testing.T) {
+				tstat := New(host)
+				tstat.SetPin(pin)
+				err := update.update(tstat)
+				if err == nil {
+					t.Fatal("error expected but no error returned")
+				}
+				var pinErr *PinError
+				if !errors.As(err, &pinErr) {
+					t.Fatal("error type invalid, got:", err.Error(), "want: *PinError")
+				}
+				if pinErr.Reason != "Invalid PIN" {
+					t.Error("reason invalid, got:", pinErr.Reason, "want: Invalid PIN")
+				}
+			})
+		}
+	}
+}
+
+func TestIsPinReason(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   bool
+	}{
+		{"Invalid PIN", true},
+		{"wrong pin", true},
+		{"Thermostat is locked", true},
+		{"Lockout active", true},
+		{"PIN-locked", true},
+		{"bad reason", false},
+		{"clock not set", false},
+		{"block", false},
+		{"fan spinning", false},
+		{"thermostat unlocked", false},
+		{"pinned", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		t.Run(test.reason, func(t *testing.T) {
+			if got := isPinReason(test.reason); got != test.want {
+				t.Error("got:", got, "want:", test.want)
+			}
+		})
+	}
+}
+
 func TestNew(t *testing.T) {
 	tstat := New("127.0.0.1")
 	t.Run("empty on creation", func(t *testing.T) {
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.mrm.dev/venstar"
+	"go.mrm.dev/venstar/exporter"
+	"go.mrm.dev/venstar/thermostat"
+)
+
+var (
+	listen    string
+	inventory string
+	tag       string
+	timeout   time.Duration
+)
+
+func init() {
+	flag.StringVar(&listen, "listen", ":9872", "Address to serve metrics on")
+	flag.StringVar(&inventory, "inventory", "", "Inventory file used to look up thermostats by alias")
+	flag.StringVar(&tag, "tag", "", "Scrape the inventory thermostats with tag when no thermostats are provided")
+	flag.DurationVar(&timeout, "timeout", exporter.DefaultTimeout, "Timeout for scraping each thermostat")
+}
+
+func main() {
+	flag.Parse()
+	targets, err := loadTargets(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "Thermostat IP or alias required")
+		os.Exit(1)
+	}
+
+	e := exporter.New(targets...)
+	e.Timeout = timeout
+
+	http.Handle("/metrics", e)
+	fmt.Println("Serving metrics for", len(targets), "thermostats on", listen)
+	if err := http.ListenAndServe(listen, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// loadTargets creates a target for each address or inventory alias. Without
+// any arguments, every inventory thermostat is scraped, limited to those with
+// the tag when set.
+func loadTargets(args []string) ([]*exporter.Target, error) {
+	var inv *venstar.Inventory
+	if inventory != "" {
+		var err error
+		inv, err = venstar.LoadInventory(inventory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var targets []*exporter.Target
+	for _, entry := range inv.Resolve(args, tag) {
+		target, err := entryTarget(entry)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func entryTarget(entry *venstar.InventoryEntry) (*exporter.Target, error) {
+	opts, err := entry.ThermostatOptions(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &exporter.Target{
+		Name:       entry.Alias,
+		Thermostat: thermostat.New(entry.Address, opts...),
+	}, nil
+}
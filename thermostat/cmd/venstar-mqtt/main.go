@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"go.mrm.dev/venstar"
+	"go.mrm.dev/venstar/mqttbridge"
+	"go.mrm.dev/venstar/thermostat"
+)
+
+var (
+	broker          string
+	clientID        string
+	username        string
+	password        string
+	prefix          string
+	discoveryPrefix string
+	noDiscovery     bool
+	interval        time.Duration
+	inventory       string
+	tag             string
+)
+
+func init() {
+	flag.StringVar(&broker, "broker", "localhost:1883", "MQTT broker address")
+	flag.StringVar(&clientID, "client-id", "venstar-mqtt", "MQTT client id")
+	flag.StringVar(&username, "username", "", "MQTT username")
+	flag.StringVar(&password, "password", "", "MQTT password, defaults to $MQTT_PASSWORD")
+	flag.StringVar(&prefix, "prefix", mqttbridge.DefaultPrefix, "Base topic for thermostat state and commands")
+	flag.StringVar(&discoveryPrefix, "discovery-prefix", mqttbridge.DefaultDiscoveryPrefix, "Home Assistant discovery prefix")
+	flag.BoolVar(&noDiscovery, "no-discovery", false, "Don't publish Home Assistant discovery configs")
+	flag.DurationVar(&interval, "interval", mqttbridge.DefaultInterval, "Delay between polling thermostats")
+	flag.StringVar(&inventory, "inventory", "", "Inventory file used to look up thermostats by alias")
+	flag.StringVar(&tag, "tag", "", "Bridge the inventory thermostats with tag when no thermostats are provided")
+}
+
+func main() {
+	flag.Parse()
+	if password == "" {
+		password = os.Getenv("MQTT_PASSWORD")
+	}
+	devices, err := loadDevices(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(devices) == 0 {
+		fmt.Fprintln(os.Stderr, "Thermostat IP or alias required")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Reconnect whenever the connection to the broker is lost.
+	for ctx.Err() == nil {
+		if err := run(ctx, devices); err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}
+}
+
+func run(ctx context.Context, devices []*mqttbridge.Device) error {
+	b := mqttbridge.New(nil, devices...)
+	b.Prefix = prefix
+	b.DiscoveryPrefix = discoveryPrefix
+	b.DisableDiscovery = noDiscovery
+	b.Interval = interval
+	b.OnError = func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	conn, err := mqttbridge.Dial(ctx, broker, &mqttbridge.ConnectOptions{
+		ClientID: clientID,
+		Username: username,
+		Password: password,
+		Will:     b.Will(),
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fmt.Println("Bridging", len(devices), "thermostats to", broker)
+	b.Client = conn
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-conn.Done()
+		cancel()
+	}()
+
+	b.Run(ctx)
+	return conn.Err()
+}
+
+// loadDevices creates a device for each address or inventory alias. Without
+// any arguments, every inventory thermostat is bridged, limited to those with
+// the tag when set.
+func loadDevices(args []string) ([]*mqttbridge.Device, error) {
+	var inv *venstar.Inventory
+	if inventory != "" {
+		var err error
+		inv, err = venstar.LoadInventory(inventory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var devices []*mqttbridge.Device
+	for _, entry := range inv.Resolve(args, tag) {
+		device, err := entryDevice(entry)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+func entryDevice(entry *venstar.InventoryEntry) (*mqttbridge.Device, error) {
+	opts, err := entry.ThermostatOptions(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &mqttbridge.Device{
+		ID:         entry.Alias,
+		Thermostat: thermostat.New(entry.Address, opts...),
+	}, nil
+}
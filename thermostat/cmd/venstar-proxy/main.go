@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.mrm.dev/venstar"
+	"go.mrm.dev/venstar/proxy"
+	"go.mrm.dev/venstar/thermostat"
+)
+
+var (
+	listen    string
+	inventory string
+	tag       string
+	cacheTTL  time.Duration
+)
+
+func init() {
+	flag.StringVar(&listen, "listen", ":8080", "Address to serve the api on")
+	flag.StringVar(&inventory, "inventory", "", "Inventory file used to look up thermostats by alias")
+	flag.StringVar(&tag, "tag", "", "Serve the inventory thermostats with tag when no thermostats are provided")
+	flag.DurationVar(&cacheTTL, "cache-ttl", proxy.DefaultCacheTTL, "How long thermostat state is cached, negative to disable")
+}
+
+func main() {
+	flag.Parse()
+	devices, err := loadDevices(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(devices) == 0 {
+		fmt.Fprintln(os.Stderr, "Thermostat IP or alias required")
+		os.Exit(1)
+	}
+
+	s := proxy.New(devices...)
+	s.CacheTTL = cacheTTL
+
+	fmt.Println("Serving", len(devices), "thermostats on", listen)
+	if err := http.ListenAndServe(listen, s); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// loadDevices creates a device for each address or inventory alias. Without
+// any arguments, every inventory thermostat is served, limited to those with
+// the tag when set.
+func loadDevices(args []string) ([]*proxy.Device, error) {
+	var inv *venstar.Inventory
+	if inventory != "" {
+		var err error
+		inv, err = venstar.LoadInventory(inventory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var devices []*proxy.Device
+	for _, entry := range inv.Resolve(args, tag) {
+		device, err := entryDevice(entry)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+func entryDevice(entry *venstar.InventoryEntry) (*proxy.Device, error) {
+	opts, err := entry.ThermostatOptions(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &proxy.Device{
+		ID:         entry.Alias,
+		Name:       entry.Name,
+		Tags:       entry.Tags,
+		Thermostat: thermostat.New(entry.Address, opts...),
+	}, nil
+}
@@ -1,20 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"sort"
 	"strings"
 
+	"go.mrm.dev/venstar"
 	"go.mrm.dev/venstar/thermostat"
 )
 
 var (
+	pin       string
+	inventory string
+	dryRun    bool
+
 	controlMode string
 	controlFan  string
-	controlHeat int
-	controlCool int
+	controlHeat float64
+	controlCool float64
 
 	settingTempUnits          string
 	settingAway               string
@@ -24,10 +30,13 @@ var (
 )
 
 func init() {
+	flag.StringVar(&pin, "pin", "", "Unlock pin used when updating a locked thermostat")
+	flag.StringVar(&inventory, "inventory", "", "Inventory file used to look up the thermostat by alias")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the update requests instead of sending them")
 	flag.StringVar(&controlMode, "controls.mode", "", "Update Mode off/heat/cool/auto")
 	flag.StringVar(&controlFan, "controls.fan", "", "Update Fan auto/on")
-	flag.IntVar(&controlHeat, "controls.heat", -1, "Update Heat to temp")
-	flag.IntVar(&controlCool, "controls.cool", -1, "Update Cool to temp")
+	flag.Float64Var(&controlHeat, "controls.heat", -1, "Update Heat to temp")
+	flag.Float64Var(&controlCool, "controls.cool", -1, "Update Cool to temp")
 	flag.StringVar(&settingTempUnits, "settings.tempunits", "", "Update temperature units f/c fahrenheit/celsius")
 	flag.StringVar(&settingAway, "settings.away", "", "Update Away yes/no")
 	flag.StringVar(&settingSchedule, "settings.schedule", "", "Update Schedule off/on")
@@ -42,15 +51,50 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Thermostat IP required")
 		os.Exit(1)
 	}
-	t := thermostat.New(ip)
+	var opts []thermostat.Option
+	if inventory != "" {
+		inv, err := venstar.LoadInventory(inventory)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if entry := inv.Lookup(ip); entry != nil {
+			ip = entry.Address
+			opts, err = entry.ThermostatOptions(nil)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	}
+	if dryRun {
+		opts = append(opts, thermostat.WithDryRun(func(p *thermostat.Plan) {
+			fmt.Println("Dry run:", p)
+		}))
+	}
+	t := thermostat.New(ip, opts...)
+	if pin != "" {
+		t.SetPin(pin)
+	}
 
 	processUpdates(t)
 	printInfo(t)
 }
 
 func processUpdates(t *thermostat.Thermostat) {
+	var info *thermostat.QueryInfo
+	queryInfo := func() *thermostat.QueryInfo {
+		if info == nil {
+			var err error
+			info, err = t.GetQueryInfo()
+			if err != nil {
+				panic(err)
+			}
+		}
+		return info
+	}
 	if controlMode != "" || controlFan != "" || controlHeat != -1 || controlCool != -1 {
-		update := thermostat.NewControlRequest()
+		update := thermostat.NewControlRequestFor(queryInfo())
 		switch controlMode {
 		case "off":
 			update.SetMode(0)
@@ -87,10 +131,12 @@ func processUpdates(t *thermostat.Thermostat) {
 		if err != nil {
 			panic(err)
 		}
-		fmt.Println("Controls updated!")
+		if !dryRun {
+			fmt.Println("Controls updated!")
+		}
 	}
 	if settingTempUnits != "" || settingAway != "" || settingSchedule != "" || settingHumidifySetPoint != -1 || settingDehumidifySetPoint != -1 {
-		update := thermostat.NewSettingsRequest()
+		update := thermostat.NewSettingsRequestFor(queryInfo())
 		switch settingTempUnits {
 		case "f", "fahrenheit":
 			update.Fahrenheit()
@@ -134,78 +180,74 @@ func processUpdates(t *thermostat.Thermostat) {
 		if err != nil {
 			panic(err)
 		}
-		fmt.Println("Settings updated!")
+		if !dryRun {
+			fmt.Println("Settings updated!")
+		}
 	}
 }
 
 func printInfo(t *thermostat.Thermostat) {
+	snap, err := t.Snapshot(context.Background())
+
 	fmt.Println("API Info:")
-	info, err := t.GetAPIInfo()
-	if err != nil {
-		panic(err)
+	if info := snap.APIInfo; info != nil {
+		fmt.Println("  Type     :", info.Type)
+		fmt.Println("  Model    :", info.Model)
+		fmt.Println("  Version  :", info.Version)
+		fmt.Println("  Firmware :", info.Firmware)
 	}
-	fmt.Println("  Type     :", info.Type)
-	fmt.Println("  Model    :", info.Model)
-	fmt.Println("  Version  :", info.Version)
-	fmt.Println("  Firmware :", info.Firmware)
 
 	fmt.Println("Query Info:")
-	qinfo, err := t.GetQueryInfo()
-	if err != nil {
-		panic(err)
+	if qinfo := snap.QueryInfo; qinfo != nil {
+		fmt.Printf("  Name               : %s\n", qinfo.Name)
+		fmt.Printf("  Mode               : %s (%d)\n", qinfo.Mode.String(), qinfo.Mode)
+		fmt.Printf("  State              : %s (%d)\n", qinfo.State.String(), qinfo.State)
+		fmt.Printf("  Fan                : %s (%d)\n", qinfo.Fan.String(), qinfo.Fan)
+		fmt.Printf("  FanState           : %s (%d)\n", qinfo.FanState.String(), qinfo.FanState)
+		fmt.Printf("  ActiveStage        : %d\n", qinfo.ActiveStage)
+		fmt.Printf("  TempUnits          : %s (%d)\n", qinfo.TempUnits.String(), qinfo.TempUnits)
+		fmt.Printf("  Schedule           : %s (%d)\n", qinfo.Schedule.String(), qinfo.Schedule)
+		fmt.Printf("  SchedulePart       : %s (%d)\n", qinfo.SchedulePart.String(), qinfo.SchedulePart)
+		fmt.Printf("  Away               : %s (%d)\n", qinfo.Away.String(), qinfo.Away)
+		fmt.Printf("  Holiday            : %s (%d)\n", qinfo.Holiday.String(), qinfo.Holiday)
+		fmt.Printf("  Override           : %s (%d)\n", qinfo.Override.String(), qinfo.Override)
+		fmt.Printf("  OverrideRemaining  : %s (%d)\n", qinfo.OverrideRemaining.String(), qinfo.OverrideRemaining)
+		fmt.Printf("  ForceUnoccupied    : %s (%d)\n", qinfo.ForceUnoccupied.String(), qinfo.ForceUnoccupied)
+		fmt.Printf("  SpaceTemp          : %.1f\n", qinfo.SpaceTemp)
+		fmt.Printf("  HeatTemp           : %.1f\n", qinfo.HeatTemp)
+		fmt.Printf("  CoolTemp           : %.1f\n", qinfo.CoolTemp)
+		fmt.Printf("  CoolTempMin        : %.1f\n", qinfo.CoolTempMin)
+		fmt.Printf("  CoolTempMax        : %.1f\n", qinfo.CoolTempMax)
+		fmt.Printf("  HeatTempMin        : %.1f\n", qinfo.HeatTempMin)
+		fmt.Printf("  HeatTempMax        : %.1f\n", qinfo.HeatTempMax)
+		fmt.Printf("  HumidityEnabled    : %s (%d)\n", qinfo.HumidityEnabled.String(), qinfo.HumidityEnabled)
+		fmt.Printf("  Humidity           : %d%%\n", qinfo.Humidity)
+		fmt.Printf("  HumidifySetPoint   : %d%%\n", qinfo.HumidifySetPoint)
+		fmt.Printf("  DehumidifySetPoint : %d%%\n", qinfo.DehumidifySetPoint)
+		fmt.Printf("  SetPointDelta      : %.1f\n", qinfo.SetPointDelta)
+		fmt.Printf("  AvailableModes     : %s (%d)\n", qinfo.AvailableModes.String(), qinfo.AvailableModes)
 	}
-	fmt.Printf("  Name               : %s\n", qinfo.Name)
-	fmt.Printf("  Mode               : %s (%d)\n", qinfo.Mode.String(), qinfo.Mode)
-	fmt.Printf("  State              : %s (%d)\n", qinfo.State.String(), qinfo.State)
-	fmt.Printf("  Fan                : %s (%d)\n", qinfo.Fan.String(), qinfo.Fan)
-	fmt.Printf("  FanState           : %s (%d)\n", qinfo.FanState.String(), qinfo.FanState)
-	fmt.Printf("  ActiveStage        : %d\n", qinfo.ActiveStage)
-	fmt.Printf("  TempUnits          : %s (%d)\n", qinfo.TempUnits.String(), qinfo.TempUnits)
-	fmt.Printf("  Schedule           : %s (%d)\n", qinfo.Schedule.String(), qinfo.Schedule)
-	fmt.Printf("  SchedulePart       : %s (%d)\n", qinfo.SchedulePart.String(), qinfo.SchedulePart)
-	fmt.Printf("  Away               : %s (%d)\n", qinfo.Away.String(), qinfo.Away)
-	fmt.Printf("  Holiday            : %s (%d)\n", qinfo.Holiday.String(), qinfo.Holiday)
-	fmt.Printf("  Override           : %s (%d)\n", qinfo.Override.String(), qinfo.Override)
-	fmt.Printf("  OverrideRemaining  : %s (%d)\n", qinfo.OverrideRemaining.String(), qinfo.OverrideRemaining)
-	fmt.Printf("  ForceUnoccupied    : %s (%d)\n", qinfo.ForceUnoccupied.String(), qinfo.ForceUnoccupied)
-	fmt.Printf("  SpaceTemp          : %.1f\n", qinfo.SpaceTemp)
-	fmt.Printf("  HeatTemp           : %.1f\n", qinfo.HeatTemp)
-	fmt.Printf("  CoolTemp           : %.1f\n", qinfo.CoolTemp)
-	fmt.Printf("  CoolTempMin        : %.1f\n", qinfo.CoolTempMin)
-	fmt.Printf("  CoolTempMax        : %.1f\n", qinfo.CoolTempMax)
-	fmt.Printf("  HeatTempMin        : %.1f\n", qinfo.HeatTempMin)
-	fmt.Printf("  HeatTempMax        : %.1f\n", qinfo.HeatTempMax)
-	fmt.Printf("  HumidityEnabled    : %s (%d)\n", qinfo.HumidityEnabled.String(), qinfo.HumidityEnabled)
-	fmt.Printf("  Humidity           : %d%%\n", qinfo.Humidity)
-	fmt.Printf("  HumidifySetPoint   : %d%%\n", qinfo.HumidifySetPoint)
-	fmt.Printf("  DehumidifySetPoint : %d%%\n", qinfo.DehumidifySetPoint)
-	fmt.Printf("  SetPointDelta      : %.1f\n", qinfo.SetPointDelta)
-	fmt.Printf("  AvailableModes     : %s (%d)\n", qinfo.AvailableModes.String(), qinfo.AvailableModes)
 
 	fmt.Println("Query Sensors:")
-	sensors, err := t.GetQuerySensors()
-	if err != nil {
-		panic(err)
-	}
-	for _, sensor := range sensors {
+	for _, sensor := range snap.Sensors {
 		fmt.Printf("  %s = %.1f\n", sensor.Name, sensor.Temp)
 	}
 
 	fmt.Println("Query Runtimes:")
-	runtimes, err := t.GetQueryRuntimes()
-	if err != nil {
-		panic(err)
+	if len(snap.Runtimes) != 0 {
+		printRuntimes(snap.Runtimes)
 	}
-	printRuntimes(runtimes)
 
 	fmt.Println("Query Alerts:")
-	alerts, err := t.GetQueryAlerts()
-	if err != nil {
-		panic(err)
-	}
-	for _, alert := range alerts {
+	for _, alert := range snap.Alerts {
 		fmt.Printf("  %10s: Active = %v\n", alert.Name, alert.Active)
 	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error retreiving thermostat info:")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
 func printRuntimes(runtimes []*thermostat.Runtime) {
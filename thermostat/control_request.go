@@ -1,8 +1,9 @@
 package thermostat
 
 import (
-	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -11,12 +12,29 @@ import (
 
 // ControlRequest is the object used to update control values on the thermostat.
 // Any attribute set to null will not be included in the request.
+//
+// Temperatures are in the units the thermostat is configured for. Fahrenheit
+// set points are whole degrees while Celsius set points may be in half
+// degrees, see SetUnits and TempUnits.Round.
 type ControlRequest struct {
-	Mode      *int `json:"mode,omitempty"`
-	Fan       *int `json:"fan,omitempty"`
-	HeatTemp  *int `json:"heattemp,omitempty"`
-	CoolTemp  *int `json:"cooltemp,omitempty"`
+	Mode      *int     `json:"mode,omitempty"`
+	Fan       *int     `json:"fan,omitempty"`
+	HeatTemp  *float64 `json:"heattemp,omitempty"`
+	CoolTemp  *float64 `json:"cooltemp,omitempty"`
+	units     *TempUnits
 	validator func(*ControlRequest) error
+	// errs are recorded by setters which could not be applied and are
+	// returned by Validate.
+	errs ValidationErrors
+}
+
+// SetUnits sets the temperature units the thermostat is configured for, which
+// determines the set point increments accepted by validation. When the units
+// are not set, only whole degrees are accepted as a fahrenheit thermostat
+// would silently truncate half degrees.
+func (cr *ControlRequest) SetUnits(units TempUnits) *ControlRequest {
+	cr.units = &units
+	return cr
 }
 
 // SetMode sets the mode 0:off 1:heat 2:cool 3:auto
@@ -45,41 +63,47 @@ func (cr *ControlRequest) FanOn() *ControlRequest {
 }
 
 // SetHeatTemp sets the heat to temperature
-func (cr *ControlRequest) SetHeatTemp(value int) *ControlRequest {
-	cr.HeatTemp = new(int)
+func (cr *ControlRequest) SetHeatTemp(value float64) *ControlRequest {
+	cr.HeatTemp = new(float64)
 	*cr.HeatTemp = value
 	return cr
 }
 
 // SetCoolTemp sets the cool to temperature
-func (cr *ControlRequest) SetCoolTemp(value int) *ControlRequest {
-	cr.CoolTemp = new(int)
+func (cr *ControlRequest) SetCoolTemp(value float64) *ControlRequest {
+	cr.CoolTemp = new(float64)
 	*cr.CoolTemp = value
 	return cr
 }
 
 // Off is a shortcut to `SetMode(0)` as well as the heat and cool temperatures.
-func (cr *ControlRequest) Off(cool, heat int) *ControlRequest {
+func (cr *ControlRequest) Off(cool, heat float64) *ControlRequest {
 	return cr.SetMode(0).SetCoolTemp(cool).SetHeatTemp(heat)
 }
 
 // Heat is a shortcut to `SetMode(1)` as well as the heat and cool temperatures.
-func (cr *ControlRequest) Heat(heat, cool int) *ControlRequest {
+func (cr *ControlRequest) Heat(heat, cool float64) *ControlRequest {
 	return cr.SetMode(1).SetHeatTemp(heat).SetCoolTemp(cool)
 }
 
 // Cool is a shortcut to `SetMode(2)` as well as the heat and cool temperatures.
-func (cr *ControlRequest) Cool(cool, heat int) *ControlRequest {
+func (cr *ControlRequest) Cool(cool, heat float64) *ControlRequest {
 	return cr.SetMode(2).SetCoolTemp(cool).SetHeatTemp(heat)
 }
 
 // Auto is a shortcut to `SetMode(3)` as well as the heat and cool temperatures.
-func (cr *ControlRequest) Auto(cool, heat int) *ControlRequest {
+func (cr *ControlRequest) Auto(cool, heat float64) *ControlRequest {
 	return cr.SetMode(3).SetCoolTemp(cool).SetHeatTemp(heat)
 }
 
 // Validate verifies the update request has compatible settings
 func (cr *ControlRequest) Validate() error {
+	if err := cr.errs.err(); err != nil {
+		return err
+	}
+	if cr.validator == nil {
+		return defaultControlRequestValidator(cr)
+	}
 	return cr.validator(cr)
 }
 
@@ -97,10 +121,10 @@ func (cr *ControlRequest) BuildRequest(req *http.Request) error {
 		params.Set("fan", strconv.Itoa(*cr.Fan))
 	}
 	if cr.HeatTemp != nil {
-		params.Set("heattemp", strconv.Itoa(*cr.HeatTemp))
+		params.Set("heattemp", formatTemp(*cr.HeatTemp))
 	}
 	if cr.CoolTemp != nil {
-		params.Set("cooltemp", strconv.Itoa(*cr.CoolTemp))
+		params.Set("cooltemp", formatTemp(*cr.CoolTemp))
 	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	body := params.Encode()
@@ -109,20 +133,52 @@ func (cr *ControlRequest) BuildRequest(req *http.Request) error {
 	return nil
 }
 
+// formatTemp encodes the temperature without trailing zeros, such as `72`
+// or `21.5`.
+func formatTemp(temp float64) string {
+	return strconv.FormatFloat(temp, 'f', -1, 64)
+}
+
+// checkTempIncrement verifies the temperature is a set point the thermostat
+// accepts in the provided units rather than silently truncating.
+func checkTempIncrement(field string, temp float64, units *TempUnits) *ValidationError {
+	if units == nil {
+		if temp != math.Round(temp) {
+			return &ValidationError{Field: field, Message: fmt.Sprintf("%s %v must be in whole degrees when the units are unknown", field, temp)}
+		}
+		return nil
+	}
+	if temp != units.Round(temp) {
+		return &ValidationError{Field: field, Message: fmt.Sprintf("%s %v must be in %v degree increments in %s", field, temp, units.Increment(), units)}
+	}
+	return nil
+}
+
 func defaultControlRequestValidator(cr *ControlRequest) error {
 	// All control calls with mode must include heattemp and cooltemp parameters.
 	if cr.Mode != nil {
 		if cr.HeatTemp == nil {
-			return errors.New("HeatTemp must be defined when Mode is defined")
+			return &ValidationError{Field: "HeatTemp", Message: "HeatTemp must be defined when Mode is defined"}
 		}
 		if cr.CoolTemp == nil {
-			return errors.New("CoolTemp must be defined when Mode is defined")
+			return &ValidationError{Field: "CoolTemp", Message: "CoolTemp must be defined when Mode is defined"}
 		}
 	}
-	// When setting mode to Auto, cooltemp must be greater than heattemp and the setpointdelta from "/query/info" needs to be respected
+	// When setting mode to Auto, cooltemp must be greater than heattemp.
+	// NewControlRequestFor additionally respects the setpointdelta from "/query/info".
 	if cr.Mode != nil && *cr.Mode == 3 {
 		if *cr.CoolTemp <= *cr.HeatTemp {
-			return errors.New("CoolTemp must be greater than HeatTemp when Mode is Auto")
+			return &ValidationError{Field: "CoolTemp", Message: "CoolTemp must be greater than HeatTemp when Mode is Auto"}
+		}
+	}
+	if cr.HeatTemp != nil {
+		if err := checkTempIncrement("HeatTemp", *cr.HeatTemp, cr.units); err != nil {
+			return err
+		}
+	}
+	if cr.CoolTemp != nil {
+		if err := checkTempIncrement("CoolTemp", *cr.CoolTemp, cr.units); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -134,3 +190,97 @@ func NewControlRequest() *ControlRequest {
 		validator: defaultControlRequestValidator,
 	}
 }
+
+// NewControlRequestFor initializes a new ControlRequest object validated
+// against the limits reported by the thermostat. In addition to the default
+// checks, the mode must be one of the AvailableModes, the heat and cool
+// temperatures must be within their min and max and in increments accepted
+// for the thermostat's TempUnits, and in auto mode the cool
+// temperature must be at least SetPointDelta above the heat temperature.
+// Temperatures not included in the request are taken from info.
+//
+// All failing fields are reported, multiple failures are returned as
+// ValidationErrors.
+func NewControlRequestFor(info *QueryInfo) *ControlRequest {
+	units := info.TempUnits
+	return &ControlRequest{
+		units:     &units,
+		validator: limitsControlRequestValidator(info),
+	}
+}
+
+func limitsControlRequestValidator(info *QueryInfo) func(*ControlRequest) error {
+	return func(cr *ControlRequest) error {
+		var errs ValidationErrors
+		if cr.Mode != nil {
+			if cr.HeatTemp == nil {
+				errs = append(errs, &ValidationError{Field: "HeatTemp", Message: "HeatTemp must be defined when Mode is defined"})
+			}
+			if cr.CoolTemp == nil {
+				errs = append(errs, &ValidationError{Field: "CoolTemp", Message: "CoolTemp must be defined when Mode is defined"})
+			}
+			if mode := Mode(*cr.Mode); !info.AvailableModes.Supports(mode) {
+				errs = append(errs, &ValidationError{
+					Field:   "Mode",
+					Message: fmt.Sprintf("Mode %s is not available, available modes: %s", modeName(mode), info.AvailableModes),
+				})
+			}
+		}
+
+		heat, cool := info.HeatTemp, info.CoolTemp
+		if cr.HeatTemp != nil {
+			heat = *cr.HeatTemp
+			if err := checkTempIncrement("HeatTemp", heat, cr.units); err != nil {
+				errs = append(errs, err)
+			}
+			if err := checkTempRange("HeatTemp", heat, info.HeatTempMin, info.HeatTempMax); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if cr.CoolTemp != nil {
+			cool = *cr.CoolTemp
+			if err := checkTempIncrement("CoolTemp", cool, cr.units); err != nil {
+				errs = append(errs, err)
+			}
+			if err := checkTempRange("CoolTemp", cool, info.CoolTempMin, info.CoolTempMax); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		mode := info.Mode
+		if cr.Mode != nil {
+			mode = Mode(*cr.Mode)
+		}
+		changed := cr.Mode != nil || cr.HeatTemp != nil || cr.CoolTemp != nil
+		if changed && mode == ModeAuto {
+			switch {
+			case info.SetPointDelta > 0 && cool-heat < info.SetPointDelta:
+				errs = append(errs, &ValidationError{
+					Field:   "CoolTemp",
+					Message: fmt.Sprintf("CoolTemp %v must be at least %v above HeatTemp %v when Mode is Auto", cool, info.SetPointDelta, heat),
+				})
+			case cool <= heat:
+				errs = append(errs, &ValidationError{
+					Field:   "CoolTemp",
+					Message: fmt.Sprintf("CoolTemp %v must be greater than HeatTemp %v when Mode is Auto", cool, heat),
+				})
+			}
+		}
+		return errs.err()
+	}
+}
+
+// checkTempRange verifies the temperature is within min and max. Limits the
+// thermostat did not report are not checked.
+func checkTempRange(field string, temp, min, max float64) *ValidationError {
+	if max == 0 {
+		return nil
+	}
+	if temp < min || temp > max {
+		return &ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("%s %v must be between %v and %v", field, temp, min, max),
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -25,7 +26,7 @@ func TestClientUpdateControls(t *testing.T) {
 		}
 	})
 	t.Run("response errors get returned", func(t *testing.T) {
-		wantErr := `Control Request update error: bad reason`
+		wantErr := `/control request failed: bad reason`
 		tstat := &Thermostat{
 			client: &fakeThermostatClient{
 				body: `{"error": true, "reason": "bad reason"}`,
@@ -39,9 +40,16 @@ func TestClientUpdateControls(t *testing.T) {
 		if err.Error() != wantErr {
 			t.Fatal("error invalid, got:", err.Error(), "want:", wantErr)
 		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatal("error type invalid, got:", err, "want: *APIError")
+		}
+		if apiErr.Endpoint != "/control" || apiErr.Reason != "bad reason" {
+			t.Errorf("APIError invalid, got: %+v", apiErr)
+		}
 	})
 	t.Run("unknown errors captured", func(t *testing.T) {
-		wantErr := `Control Request unknown error`
+		wantErr := `/control request failed: unknown error`
 		tstat := &Thermostat{
 			client: &fakeThermostatClient{
 				body: `{"success": false}`,
@@ -120,7 +128,7 @@ func TestControlRequestFanOn(t *testing.T) {
 
 func TestControlRequestSetHeatTemp(t *testing.T) {
 	cr := NewControlRequest()
-	want := 0
+	want := 0.0
 	cr.SetHeatTemp(want)
 	if cr.HeatTemp == nil {
 		t.Fatal("HeatTemp invalid, got: nil want:", want)
@@ -132,7 +140,7 @@ func TestControlRequestSetHeatTemp(t *testing.T) {
 
 func TestControlRequestSetCoolTemp(t *testing.T) {
 	cr := NewControlRequest()
-	want := 0
+	want := 0.0
 	cr.SetCoolTemp(want)
 	if cr.CoolTemp == nil {
 		t.Fatal("CoolTemp invalid, got: nil want:", want)
@@ -145,8 +153,8 @@ func TestControlRequestSetCoolTemp(t *testing.T) {
 func TestControlRequestOff(t *testing.T) {
 	cr := NewControlRequest()
 	wantMode := 0
-	wantCool := 70
-	wantHeat := 65
+	wantCool := 70.0
+	wantHeat := 65.0
 	cr.Off(wantCool, wantHeat)
 	if cr.Mode == nil {
 		t.Fatal("Mode invalid, got: nil want:", wantMode)
@@ -171,8 +179,8 @@ func TestControlRequestOff(t *testing.T) {
 func TestControlRequestHeat(t *testing.T) {
 	cr := NewControlRequest()
 	wantMode := 1
-	wantCool := 70
-	wantHeat := 65
+	wantCool := 70.0
+	wantHeat := 65.0
 	cr.Heat(wantHeat, wantCool)
 	if cr.Mode == nil {
 		t.Fatal("Mode invalid, got: nil want:", wantMode)
@@ -197,8 +205,8 @@ func TestControlRequestHeat(t *testing.T) {
 func TestControlRequestCool(t *testing.T) {
 	cr := NewControlRequest()
 	wantMode := 2
-	wantCool := 70
-	wantHeat := 65
+	wantCool := 70.0
+	wantHeat := 65.0
 	cr.Cool(wantCool, wantHeat)
 	if cr.Mode == nil {
 		t.Fatal("Mode invalid, got: nil want:", wantMode)
@@ -223,8 +231,8 @@ func TestControlRequestCool(t *testing.T) {
 func TestControlRequestAuto(t *testing.T) {
 	cr := NewControlRequest()
 	wantMode := 3
-	wantCool := 70
-	wantHeat := 65
+	wantCool := 70.0
+	wantHeat := 65.0
 	cr.Auto(wantCool, wantHeat)
 	if cr.Mode == nil {
 		t.Fatal("Mode invalid, got: nil want:", wantMode)
@@ -295,10 +303,10 @@ func TestControlRequestValidate(t *testing.T) {
 				cr.SetFan(test.fan)
 			}
 			if test.heat != -1 {
-				cr.SetHeatTemp(test.heat)
+				cr.SetHeatTemp(float64(test.heat))
 			}
 			if test.cool != -1 {
-				cr.SetCoolTemp(test.cool)
+				cr.SetCoolTemp(float64(test.cool))
 			}
 			err := cr.Validate()
 			if test.errExp != "" && err == nil {
@@ -312,6 +320,13 @@ func TestControlRequestValidate(t *testing.T) {
 			}
 		})
 	}
+	t.Run("zero value uses default validator", func(t *testing.T) {
+		cr := &ControlRequest{}
+		cr.SetMode(1)
+		if err := cr.Validate(); !errors.Is(err, ErrValidation) {
+			t.Error("Error invalid, got:", err, "want:", ErrValidation)
+		}
+	})
 }
 
 func TestControlRequestBuildRequest(t *testing.T) {
@@ -341,10 +356,10 @@ func TestControlRequestBuildRequest(t *testing.T) {
 				cr.SetFan(test.fan)
 			}
 			if test.heat != -1 {
-				cr.SetHeatTemp(test.heat)
+				cr.SetHeatTemp(float64(test.heat))
 			}
 			if test.cool != -1 {
-				cr.SetCoolTemp(test.cool)
+				cr.SetCoolTemp(float64(test.cool))
 			}
 			validateCalled := false
 			cr.validator = func(_ *ControlRequest) error {
@@ -387,3 +402,148 @@ func TestControlRequestBuildRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestNewControlRequestFor(t *testing.T) {
+	info := &QueryInfo{
+		Mode:           ModeHeat,
+		HeatTemp:       68,
+		CoolTemp:       74,
+		HeatTempMin:    35,
+		HeatTempMax:    90,
+		CoolTempMin:    35,
+		CoolTempMax:    99,
+		SetPointDelta:  4,
+		AvailableModes: 0,
+	}
+	tests := []struct {
+		name   string
+		info   func(QueryInfo) QueryInfo
+		update func(*ControlRequest)
+		errExp string
+		fields []string
+	}{
+		{"no error when empty", nil, func(cr *ControlRequest) {}, "", nil},
+		{"within limits", nil, func(cr *ControlRequest) { cr.Heat(70, 78) }, "", nil},
+		{"missing temps", nil, func(cr *ControlRequest) { cr.SetMode(1) },
+			"HeatTemp must be defined when Mode is defined; CoolTemp must be defined when Mode is defined", []string{"HeatTemp", "CoolTemp"}},
+		{"heat below min", nil, func(cr *ControlRequest) { cr.SetHeatTemp(30) },
+			"HeatTemp 30 must be between 35 and 90", []string{"HeatTemp"}},
+		{"heat above max", nil, func(cr *ControlRequest) { cr.SetHeatTemp(91) },
+			"HeatTemp 91 must be between 35 and 90", []string{"HeatTemp"}},
+		{"cool above max", nil, func(cr *ControlRequest) { cr.SetCoolTemp(100) },
+			"CoolTemp 100 must be between 35 and 99", []string{"CoolTemp"}},
+		{"limits not reported", func(i QueryInfo) QueryInfo { i.HeatTempMax = 0; return i },
+			func(cr *ControlRequest) { cr.SetHeatTemp(30) }, "", nil},
+		{"mode unavailable", func(i QueryInfo) QueryInfo { i.AvailableModes = 2; return i },
+			func(cr *ControlRequest) { cr.Cool(78, 70) }, "Mode cool is not available, available modes: heat", []string{"Mode"}},
+		{"auto respects delta", nil, func(cr *ControlRequest) { cr.Auto(72, 70) },
+			"CoolTemp 72 must be at least 4 above HeatTemp 70 when Mode is Auto", []string{"CoolTemp"}},
+		{"auto at delta", nil, func(cr *ControlRequest) { cr.Auto(74, 70) }, "", nil},
+		{"auto uses current temps", func(i QueryInfo) QueryInfo { i.Mode = ModeAuto; return i },
+			func(cr *ControlRequest) { cr.SetHeatTemp(72) }, "CoolTemp 74 must be at least 4 above HeatTemp 72 when Mode is Auto", []string{"CoolTemp"}},
+		{"auto without delta", func(i QueryInfo) QueryInfo { i.SetPointDelta = 0; return i },
+			func(cr *ControlRequest) { cr.Auto(70, 70) }, "CoolTemp 70 must be greater than HeatTemp 70 when Mode is Auto", []string{"CoolTemp"}},
+		{"multiple fields", func(i QueryInfo) QueryInfo { i.AvailableModes = 3; return i },
+			func(cr *ControlRequest) { cr.Heat(95, 100) },
+			"Mode heat is not available, available modes: cool; HeatTemp 95 must be between 35 and 90; CoolTemp 100 must be between 35 and 99",
+			[]string{"Mode", "HeatTemp", "CoolTemp"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testInfo := *info
+			if test.info != nil {
+				testInfo = test.info(testInfo)
+			}
+			cr := NewControlRequestFor(&testInfo)
+			test.update(cr)
+			err := cr.Validate()
+			if test.errExp == "" {
+				if err != nil {
+					t.Fatal("Error invalid, got:", err.Error(), "want: nil")
+				}
+				return
+			}
+			if err == nil || err.Error() != test.errExp {
+				t.Fatal("Error invalid, got:", err, "want:", test.errExp)
+			}
+			if !errors.Is(err, ErrValidation) {
+				t.Error("Error does not match ErrValidation, got:", err)
+			}
+			var fields []string
+			var verrs ValidationErrors
+			var verr *ValidationError
+			switch {
+			case errors.As(err, &verrs):
+				for _, e := range verrs {
+					fields = append(fields, e.Field)
+				}
+			case errors.As(err, &verr):
+				fields = append(fields, verr.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+				t.Error("Fields invalid, got:", fields, "want:", test.fields)
+			}
+		})
+	}
+}
+
+func TestControlRequestTempIncrements(t *testing.T) {
+	fahrenheit, celsius := Fahrenheit, Celsius
+	tests := []struct {
+		name   string
+		units  *TempUnits
+		heat   float64
+		cool   float64
+		body   string
+		errExp string
+	}{
+		{"fahrenheit whole", &fahrenheit, 70, 75, "cooltemp=75&heattemp=70", ""},
+		{"fahrenheit half", &fahrenheit, 70.5, 75, "", "HeatTemp 70.5 must be in 1 degree increments in fahrenheit"},
+		{"celsius half", &celsius, 21.5, 24, "cooltemp=24&heattemp=21.5", ""},
+		{"celsius tenth", &celsius, 21.5, 24.2, "", "CoolTemp 24.2 must be in 0.5 degree increments in celsius"},
+		{"unknown units whole", nil, 70, 75, "cooltemp=75&heattemp=70", ""},
+		{"unknown units half", nil, 70, 72.5, "", "CoolTemp 72.5 must be in whole degrees when the units are unknown"},
+		{"unknown units tenth", nil, 21.3, 24, "", "HeatTemp 21.3 must be in whole degrees when the units are unknown"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cr := NewControlRequest().SetHeatTemp(test.heat).SetCoolTemp(test.cool)
+			if test.units != nil {
+				cr.SetUnits(*test.units)
+			}
+			req := &http.Request{
+				Header: make(http.Header),
+			}
+			err := cr.BuildRequest(req)
+			if test.errExp != "" {
+				if err == nil || err.Error() != test.errExp {
+					t.Fatal("Error invalid, got:", err, "want:", test.errExp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("Error invalid, got:", err.Error(), "want: nil")
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal("Unexpected body read error:", err)
+			}
+			if string(body) != test.body {
+				t.Error("Body invalid, got:", string(body), "want:", test.body)
+			}
+		})
+	}
+	t.Run("NewControlRequestFor uses thermostat units", func(t *testing.T) {
+		info := &QueryInfo{TempUnits: Celsius, HeatTempMin: 5, HeatTempMax: 30, CoolTempMin: 5, CoolTempMax: 35}
+		if err := NewControlRequestFor(info).SetHeatTemp(21.5).Validate(); err != nil {
+			t.Error("Error invalid, got:", err.Error(), "want: nil")
+		}
+		info.TempUnits = Fahrenheit
+		info.HeatTempMax = 90
+		err := NewControlRequestFor(info).SetHeatTemp(70.5).Validate()
+		want := "HeatTemp 70.5 must be in 1 degree increments in fahrenheit"
+		if err == nil || err.Error() != want {
+			t.Error("Error invalid, got:", err, "want:", want)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package thermostat
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// FieldChange describes a value which differs between two readings.
+type FieldChange struct {
+	// Field is the QueryInfo field name, or the sensor or alert name.
+	Field string
+	// Old and New are the raw values, such as Mode or float64. They are nil
+	// when a sensor or alert is only present in one of the readings.
+	Old interface{}
+	New interface{}
+	// OldText and NewText are the human readable values, using the value's
+	// String method when available.
+	OldText string
+	NewText string
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.OldText, c.NewText)
+}
+
+func newFieldChange(field string, old, new interface{}) FieldChange {
+	return FieldChange{
+		Field:   field,
+		Old:     old,
+		New:     new,
+		OldText: valueText(old),
+		NewText: valueText(new),
+	}
+}
+
+// valueText returns the human readable form of the value.
+func valueText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "none"
+	case fmt.Stringer:
+		if s := v.String(); s != "" {
+			return s
+		}
+		return fmt.Sprintf("%d", v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+type diffOptions struct {
+	tolerance float64
+}
+
+// DiffOption configures Diff, DiffSensors and DiffAlerts.
+type DiffOption func(*diffOptions)
+
+// DiffTolerance ignores changes to temperatures and other float values
+// smaller than or equal to tolerance.
+func DiffTolerance(tolerance float64) DiffOption {
+	return func(o *diffOptions) {
+		o.tolerance = tolerance
+	}
+}
+
+func (o *diffOptions) floatEqual(a, b float64) bool {
+	return a == b || math.Abs(a-b) <= o.tolerance
+}
+
+func newDiffOptions(opts []DiffOption) *diffOptions {
+	o := &diffOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Diff returns the fields which changed between the old and new query info,
+// in the order they are declared in QueryInfo. When only one of old and new
+// is nil every field is included, with a nil Old or New.
+func Diff(old, new *QueryInfo, opts ...DiffOption) []FieldChange {
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil:
+		return diffAll(new, func(name string, v interface{}) FieldChange {
+			return newFieldChange(name, nil, v)
+		})
+	case new == nil:
+		return diffAll(old, func(name string, v interface{}) FieldChange {
+			return newFieldChange(name, v, nil)
+		})
+	}
+	o := newDiffOptions(opts)
+	ov := reflect.ValueOf(old).Elem()
+	nv := reflect.ValueOf(new).Elem()
+	var changes []FieldChange
+	for i := 0; i < ov.NumField(); i++ {
+		of, nf := ov.Field(i), nv.Field(i)
+		if of.Kind() == reflect.Float64 {
+			if o.floatEqual(of.Float(), nf.Float()) {
+				continue
+			}
+		} else if of.Interface() == nf.Interface() {
+			continue
+		}
+		changes = append(changes, newFieldChange(ov.Type().Field(i).Name, of.Interface(), nf.Interface()))
+	}
+	return changes
+}
+
+// diffAll returns a change for every field of info, built by change.
+func diffAll(info *QueryInfo, change func(name string, v interface{}) FieldChange) []FieldChange {
+	v := reflect.ValueOf(info).Elem()
+	changes := make([]FieldChange, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		changes = append(changes, change(v.Type().Field(i).Name, v.Field(i).Interface()))
+	}
+	return changes
+}
+
+// DiffSensors returns the sensors whose temperature changed, keyed by sensor
+// name. Sensors only present in one of the readings are included with a nil
+// Old or New.
+func DiffSensors(old, new []*Sensor, opts ...DiffOption) []FieldChange {
+	o := newDiffOptions(opts)
+	var changes []FieldChange
+	for _, cur := range new {
+		prev := findSensor(old, cur.Name)
+		switch {
+		case prev == nil:
+			changes = append(changes, newFieldChange(cur.Name, nil, cur.Temp))
+		case !o.floatEqual(prev.Temp, cur.Temp):
+			changes = append(changes, newFieldChange(cur.Name, prev.Temp, cur.Temp))
+		}
+	}
+	for _, prev := range old {
+		if findSensor(new, prev.Name) == nil {
+			changes = append(changes, newFieldChange(prev.Name, prev.Temp, nil))
+		}
+	}
+	return changes
+}
+
+// DiffAlerts returns the alerts whose active state changed, keyed by alert
+// name. Alerts only present in one of the readings are included with a nil
+// Old or New.
+func DiffAlerts(old, new []*Alert) []FieldChange {
+	var changes []FieldChange
+	for _, cur := range new {
+		prev := findAlert(old, cur.Name)
+		switch {
+		case prev == nil:
+			changes = append(changes, newFieldChange(cur.Name, nil, cur.Active))
+		case prev.Active != cur.Active:
+			changes = append(changes, newFieldChange(cur.Name, prev.Active, cur.Active))
+		}
+	}
+	for _, prev := range old {
+		if findAlert(new, prev.Name) == nil {
+			changes = append(changes, newFieldChange(prev.Name, prev.Active, nil))
+		}
+	}
+	return changes
+}
+
+func findSensor(sensors []*Sensor, name string) *Sensor {
+	for _, sensor := range sensors {
+		if sensor.Name == name {
+			return sensor
+		}
+	}
+	return nil
+}
+
+func findAlert(alerts []*Alert, name string) *Alert {
+	for _, alert := range alerts {
+		if alert.Name == name {
+			return alert
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package thermostat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*QueryInfo)
+		opts   []DiffOption
+		want   []string
+	}{
+		{"no changes", func(*QueryInfo) {}, nil, nil},
+		{"enum fields use String", func(info *QueryInfo) {
+			info.Mode = ModeAuto
+			info.Fan = 1
+		}, nil, []string{"Mode: heat -> auto", "Fan: auto -> on"}},
+		{"unknown enum values use number", func(info *QueryInfo) {
+			info.Mode = 7
+		}, nil, []string{"Mode: heat -> 7"}},
+		{"float fields", func(info *QueryInfo) {
+			info.SpaceTemp = 70.5
+			info.HeatTemp = 71
+		}, nil, []string{"SpaceTemp: 70 -> 70.5", "HeatTemp: 68 -> 71"}},
+		{"float changes within tolerance ignored", func(info *QueryInfo) {
+			info.SpaceTemp = 70.5
+			info.HeatTemp = 71
+		}, []DiffOption{DiffTolerance(0.5)}, []string{"HeatTemp: 68 -> 71"}},
+		{"int and string fields", func(info *QueryInfo) {
+			info.Name = "Upstairs"
+			info.Humidity = 45
+		}, nil, []string{"Name: Downstairs -> Upstairs", "Humidity: 40 -> 45"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := &QueryInfo{Name: "Downstairs", Mode: ModeHeat, SpaceTemp: 70, HeatTemp: 68, CoolTemp: 74, Humidity: 40}
+			cur := *old
+			test.modify(&cur)
+			changes := Diff(old, &cur, test.opts...)
+			if len(changes) != len(test.want) {
+				t.Fatal("changes invalid, got:", changes, "want:", test.want)
+			}
+			for i, change := range changes {
+				if got := change.String(); got != test.want[i] {
+					t.Error("change invalid, got:", got, "want:", test.want[i])
+				}
+			}
+		})
+	}
+	t.Run("raw values keep field type", func(t *testing.T) {
+		old := &QueryInfo{Mode: ModeHeat}
+		changes := Diff(old, &QueryInfo{Mode: ModeCool})
+		if len(changes) != 1 {
+			t.Fatal("changes invalid, got:", changes)
+		}
+		if changes[0].Old != ModeHeat || changes[0].New != ModeCool {
+			t.Error("values invalid, got:", changes[0].Old, changes[0].New, "want:", ModeHeat, ModeCool)
+		}
+	})
+	t.Run("nil readings", func(t *testing.T) {
+		info := &QueryInfo{Name: "Downstairs", Mode: ModeHeat}
+		fields := reflect.TypeOf(QueryInfo{}).NumField()
+		tests := []struct {
+			name     string
+			old, new *QueryInfo
+			want     int
+		}{
+			{"both nil", nil, nil, 0},
+			{"old nil", nil, info, fields},
+			{"new nil", info, nil, fields},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				changes := Diff(test.old, test.new)
+				if len(changes) != test.want {
+					t.Fatal("changes invalid, got:", len(changes), "want:", test.want)
+				}
+				if test.want == 0 {
+					return
+				}
+				want := "Name: none -> Downstairs"
+				if test.new == nil {
+					want = "Name: Downstairs -> none"
+				}
+				if got := changes[0].String(); got != want {
+					t.Error("change invalid, got:", got, "want:", want)
+				}
+			})
+		}
+	})
+}
+
+func TestDiffSensors(t *testing.T) {
+	old := []*Sensor{
+		{Name: "Thermostat", Temp: 70},
+		{Name: "Outdoor", Temp: 40},
+		{Name: "Return", Temp: 68},
+	}
+	cur := []*Sensor{
+		{Name: "Thermostat", Temp: 70.2},
+		{Name: "Outdoor", Temp: 42},
+		{Name: "Supply", Temp: 90},
+	}
+	tests := []struct {
+		name string
+		opts []DiffOption
+		want []string
+	}{
+		{"all changes", nil, []string{
+			"Thermostat: 70 -> 70.2",
+			"Outdoor: 40 -> 42",
+			"Supply: none -> 90",
+			"Return: 68 -> none",
+		}},
+		{"tolerance", []DiffOption{DiffTolerance(0.5)}, []string{
+			"Outdoor: 40 -> 42",
+			"Supply: none -> 90",
+			"Return: 68 -> none",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := DiffSensors(old, cur, test.opts...)
+			if len(changes) != len(test.want) {
+				t.Fatal("changes invalid, got:", changes, "want:", test.want)
+			}
+			for i, change := range changes {
+				if got := change.String(); got != test.want[i] {
+					t.Error("change invalid, got:", got, "want:", test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDiffAlerts(t *testing.T) {
+	old := []*Alert{
+		{Name: "Filter", Active: false},
+		{Name: "Service", Active: true},
+		{Name: "Air Filter", Active: true},
+	}
+	cur := []*Alert{
+		{Name: "Filter", Active: true},
+		{Name: "Service", Active: true},
+		{Name: "UV Lamp", Active: false},
+	}
+	want := []string{
+		"Filter: false -> true",
+		"UV Lamp: none -> false",
+		"Air Filter: true -> none",
+	}
+	changes := DiffAlerts(old, cur)
+	if len(changes) != len(want) {
+		t.Fatal("changes invalid, got:", changes, "want:", want)
+	}
+	for i, change := range changes {
+		if got := change.String(); got != want[i] {
+			t.Error("change invalid, got:", got, "want:", want[i])
+		}
+	}
+	if changes[2].New != nil {
+		t.Error("New invalid, got:", changes[2].New, "want: nil")
+	}
+}
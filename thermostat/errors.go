@@ -0,0 +1,168 @@
+package thermostat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrValidation is matched by errors returned when a request fails
+	// validation before being sent to the thermostat.
+	ErrValidation = errors.New("validation failed")
+
+	// ErrDecode is matched by errors returned when a thermostat response could
+	// not be decoded.
+	ErrDecode = errors.New("decoding json")
+
+	// ErrResponseTooLarge is matched by errors returned when a thermostat
+	// response body exceeds the maximum size read.
+	ErrResponseTooLarge = errors.New("response too large")
+
+	// ErrUnsupported is matched by errors returned when a request uses a
+	// feature the thermostat capabilities do not support.
+	ErrUnsupported = errors.New("unsupported by thermostat")
+)
+
+// APIError is returned when the thermostat responds to a request with a
+// failure.
+type APIError struct {
+	// Endpoint is the api path requested, such as `/control`.
+	Endpoint string
+	// StatusCode is the http status code returned by the thermostat.
+	StatusCode int
+	// Reason is the failure reason provided by the thermostat, if any.
+	Reason string
+	// Body is the start of the response body when the thermostat responds
+	// with a non 2xx status.
+	Body string
+}
+
+func (e *APIError) Error() string {
+	msg := e.Endpoint + " request failed"
+	if e.StatusCode != 0 && (e.StatusCode < 200 || e.StatusCode > 299) {
+		msg += fmt.Sprintf(": status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+		if e.Body != "" {
+			msg += ": " + e.Body
+		}
+		return msg
+	}
+	reason := e.Reason
+	if reason == "" {
+		reason = "unknown error"
+	}
+	return msg + ": " + reason
+}
+
+// PinError is returned when the thermostat rejects an update because the pin
+// is missing, incorrect or the thermostat is locked out.
+type PinError struct {
+	*APIError
+}
+
+func (e *PinError) Error() string {
+	return "thermostat rejected pin: " + e.Reason
+}
+
+// Unwrap returns the underlying APIError.
+func (e *PinError) Unwrap() error {
+	return e.APIError
+}
+
+// ValidationError describes a request field which failed validation.
+// ValidationErrors match ErrValidation with errors.Is.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// ValidationErrors is returned when multiple request fields fail validation.
+// ValidationErrors match ErrValidation with errors.Is, and each
+// ValidationError may be retrieved with errors.As.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether target is ErrValidation.
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Unwrap returns the individual validation errors.
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// err returns nil when there are no errors, the single ValidationError when
+// there is one, otherwise all of the errors.
+func (e ValidationErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
+
+// err returns the error described by the update response, if any.
+func (ur *UpdateResponse) err(endpoint string, resp *http.Response) error {
+	if ur.Success && !ur.Error {
+		return nil
+	}
+	apiErr := &APIError{
+		Endpoint: endpoint,
+		Reason:   ur.Reason,
+	}
+	if resp != nil {
+		apiErr.StatusCode = resp.StatusCode
+	}
+	if isPinReason(ur.Reason) {
+		return &PinError{apiErr}
+	}
+	return apiErr
+}
+
+// pinReasonWords are the words in a failure reason indicating the pin was
+// rejected or the thermostat is locked out.
+var pinReasonWords = map[string]bool{
+	"pin":     true,
+	"lock":    true,
+	"locked":  true,
+	"lockout": true,
+}
+
+// isPinReason reports whether the reason contains one of the pinReasonWords.
+// Whole words are matched so reasons such as "clock" are not pin failures.
+func isPinReason(reason string) bool {
+	words := strings.FieldsFunc(strings.ToLower(reason), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		if pinReasonWords[word] {
+			return true
+		}
+	}
+	return false
+}
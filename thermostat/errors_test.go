@@ -0,0 +1,103 @@
+package thermostat
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAPIErrorError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *APIError
+		want string
+	}{
+		{"reason", &APIError{Endpoint: "/control", Reason: "bad reason"}, "/control request failed: bad reason"},
+		{"no reason", &APIError{Endpoint: "/settings"}, "/settings request failed: unknown error"},
+		{"status", &APIError{Endpoint: "/query/info", StatusCode: 404}, "/query/info request failed: status 404 Not Found"},
+		{"status with body", &APIError{Endpoint: "/", StatusCode: 500, Body: "oops"}, "/ request failed: status 500 Internal Server Error: oops"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.err.Error(); got != test.want {
+				t.Error("error invalid, got:", got, "want:", test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateResponseErr(t *testing.T) {
+	tests := []struct {
+		name     string
+		response UpdateResponse
+		status   int
+		wantNil  bool
+		wantPin  bool
+	}{
+		{"success", UpdateResponse{Success: true}, 200, true, false},
+		{"error", UpdateResponse{Error: true, Reason: "bad reason"}, 200, false, false},
+		{"not successful", UpdateResponse{}, 200, false, false},
+		{"pin rejected", UpdateResponse{Error: true, Reason: "Invalid PIN"}, 200, false, true},
+		{"locked out", UpdateResponse{Error: true, Reason: "Locked out"}, 403, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.response.err("/control", &http.Response{StatusCode: test.status})
+			if test.wantNil {
+				if err != nil {
+					t.Fatal("error unexpected, got:", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatal("error type invalid, got:", err, "want: *APIError")
+			}
+			if apiErr.StatusCode != test.status {
+				t.Error("StatusCode invalid, got:", apiErr.StatusCode, "want:", test.status)
+			}
+			if apiErr.Reason != test.response.Reason {
+				t.Error("Reason invalid, got:", apiErr.Reason, "want:", test.response.Reason)
+			}
+			var pinErr *PinError
+			if errors.As(err, &pinErr) != test.wantPin {
+				t.Error("PinError match invalid, got:", !test.wantPin, "want:", test.wantPin)
+			}
+		})
+	}
+}
+
+func TestErrorsMatch(t *testing.T) {
+	t.Run("validation", func(t *testing.T) {
+		tstat := &Thermostat{client: &fakeThermostatClient{body: `{"success": true}`}}
+		err := tstat.UpdateControls(NewControlRequest().SetMode(1))
+		if !errors.Is(err, ErrValidation) {
+			t.Fatal("error invalid, got:", err, "want: ErrValidation")
+		}
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Fatal("error type invalid, got:", err, "want: *ValidationError")
+		}
+		if validationErr.Field != "HeatTemp" {
+			t.Error("Field invalid, got:", validationErr.Field, "want: HeatTemp")
+		}
+	})
+	t.Run("decode", func(t *testing.T) {
+		tstat := &Thermostat{client: &fakeThermostatClient{body: `not json`}}
+		_, err := tstat.GetQueryInfo()
+		if !errors.Is(err, ErrDecode) {
+			t.Fatal("error invalid, got:", err, "want: ErrDecode")
+		}
+	})
+	t.Run("request", func(t *testing.T) {
+		tstat := &Thermostat{client: &fakeThermostatClient{error: true}}
+		_, err := tstat.GetQueryInfo()
+		if err == nil || errors.Is(err, ErrDecode) || errors.Is(err, ErrValidation) {
+			t.Fatal("error invalid, got:", err)
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			t.Error("request error unexpectedly matched *APIError")
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package thermostat
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter protects a thermostat from being overloaded by bounding the number
+// of in-flight requests and spacing out the start of each request.
+type limiter struct {
+	slots       chan struct{}
+	minInterval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newLimiter returns a limiter allowing maxInFlight concurrent requests, each
+// started at least minInterval apart. A maxInFlight less than 1 does not limit
+// concurrency.
+func newLimiter(maxInFlight int, minInterval time.Duration) *limiter {
+	l := &limiter{
+		minInterval: minInterval,
+	}
+	if maxInFlight > 0 {
+		l.slots = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// acquire waits for the limiter to allow a request to start. The returned
+// release func must be called once the request has completed.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release = func() { <-l.slots }
+	}
+	if l.minInterval > 0 {
+		l.mu.Lock()
+		start := time.Now()
+		if l.next.After(start) {
+			start = l.next
+		}
+		l.next = start.Add(l.minInterval)
+		l.mu.Unlock()
+
+		if err := sleepContext(ctx, time.Until(start)); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
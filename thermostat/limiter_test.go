@@ -0,0 +1,169 @@
+package thermostat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrencyClient records the peak number of concurrent requests.
+type concurrencyClient struct {
+	delay    time.Duration
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	mu       sync.Mutex
+	starts   []time.Time
+}
+
+func (c *concurrencyClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.starts = append(c.starts, time.Now())
+	c.mu.Unlock()
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(c.delay)
+	client := &fakeThermostatClient{body: `{"success": true}`}
+	return client.Do(req)
+}
+
+func runConcurrently(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLimiterMaxInFlight(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxInFlight int
+		wantPeak    int32
+	}{
+		{"default serializes", defaultMaxInFlight, 1},
+		{"two", 2, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &concurrencyClient{delay: 10 * time.Millisecond}
+			tstat := New("127.0.0.1", WithHTTPClient(client), WithMaxInFlight(test.maxInFlight))
+			runConcurrently(8, func(i int) {
+				var err error
+				if i%2 == 0 {
+					_, err = tstat.GetQueryInfo()
+				} else {
+					err = tstat.UpdateControls(NewControlRequest().FanOn())
+				}
+				if err != nil {
+					t.Error("error unexpected, got:", err)
+				}
+			})
+			if peak := client.peak.Load(); peak != test.wantPeak {
+				t.Error("peak in flight, got:", peak, "want:", test.wantPeak)
+			}
+		})
+	}
+	t.Run("unlimited", func(t *testing.T) {
+		client := &concurrencyClient{delay: 20 * time.Millisecond}
+		tstat := New("127.0.0.1", WithHTTPClient(client), WithMaxInFlight(0))
+		runConcurrently(4, func(int) {
+			if _, err := tstat.GetAPIInfo(); err != nil {
+				t.Error("error unexpected, got:", err)
+			}
+		})
+		if peak := client.peak.Load(); peak < 2 {
+			t.Error("peak in flight, got:", peak, "want: >1")
+		}
+	})
+}
+
+func TestLimiterMinInterval(t *testing.T) {
+	interval := 20 * time.Millisecond
+	client := &concurrencyClient{}
+	tstat := New("127.0.0.1", WithHTTPClient(client), WithMaxInFlight(0), WithMinInterval(interval))
+	runConcurrently(4, func(int) {
+		if _, err := tstat.GetAPIInfo(); err != nil {
+			t.Error("error unexpected, got:", err)
+		}
+	})
+	if len(client.starts) != 4 {
+		t.Fatal("requests, got:", len(client.starts), "want: 4")
+	}
+	first, last := client.starts[0], client.starts[0]
+	for _, start := range client.starts {
+		if start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+	// Allow for timer slack while ensuring requests were spread out.
+	if spread := last.Sub(first); spread < 3*interval-5*time.Millisecond {
+		t.Error("requests not spaced out, spread:", spread, "want at least:", 3*interval)
+	}
+}
+
+func TestLimiterContextCanceled(t *testing.T) {
+	l := newLimiter(1, 0)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal("error unexpected, got:", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("error invalid, got:", err, "want:", context.DeadlineExceeded)
+	}
+
+	l = newLimiter(0, time.Hour)
+	release, err = l.acquire(context.Background())
+	if err != nil {
+		t.Fatal("error unexpected, got:", err)
+	}
+	release()
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Error("error invalid, got:", err, "want:", context.Canceled)
+	}
+}
+
+func TestLimiterNil(t *testing.T) {
+	var l *limiter
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal("error unexpected, got:", err)
+	}
+	release()
+}
+
+func TestConcurrentSetPin(t *testing.T) {
+	client := &concurrencyClient{}
+	tstat := New("127.0.0.1", WithHTTPClient(client), WithMaxInFlight(0))
+	runConcurrently(8, func(i int) {
+		if i%2 == 0 {
+			tstat.SetPin("1234")
+			return
+		}
+		if err := tstat.UpdateSettings(NewSettingsRequest().Home()); err != nil {
+			t.Error("error unexpected, got:", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package thermostat
+
+import (
+	"context"
+	"fmt"
+)
+
+// ModifyControls updates the controls while preserving the current values.
+//
+// The current query info is fetched and used to prefill a ControlRequest with
+// the mode, fan, heat and cool temperatures before fn is applied. If fn only
+// changes one of the set points, the other is moved as needed to keep them
+// SetPointDelta apart. The request is validated against the thermostat
+// limits, see NewControlRequestFor, and submitted.
+func (t *Thermostat) ModifyControls(ctx context.Context, fn func(*ControlRequest)) error {
+	info, err := t.GetQueryInfoContext(ctx)
+	if err != nil {
+		return fmt.Errorf("modifying controls: %w", err)
+	}
+	cr := prefillControlRequest(info)
+	fn(cr)
+	adjustSetPoints(cr, info)
+	if err := t.UpdateControlsContext(ctx, cr); err != nil {
+		return fmt.Errorf("modifying controls: %w", err)
+	}
+	return nil
+}
+
+// prefillControlRequest returns a ControlRequest for the thermostat with the
+// current mode, fan and set points.
+func prefillControlRequest(info *QueryInfo) *ControlRequest {
+	return NewControlRequestFor(info).
+		SetMode(int(info.Mode)).
+		SetFan(int(info.Fan)).
+		SetHeatTemp(info.HeatTemp).
+		SetCoolTemp(info.CoolTemp)
+}
+
+// adjustSetPoints moves the set point which was not changed from the current
+// info so the heat and cool temperatures are at least SetPointDelta apart.
+// When both or neither set point changed the request is left as is.
+func adjustSetPoints(cr *ControlRequest, info *QueryInfo) {
+	delta := info.SetPointDelta
+	if delta <= 0 || cr.HeatTemp == nil || cr.CoolTemp == nil {
+		return
+	}
+	heatChanged := *cr.HeatTemp != info.HeatTemp
+	coolChanged := *cr.CoolTemp != info.CoolTemp
+	if *cr.CoolTemp-*cr.HeatTemp >= delta {
+		return
+	}
+	switch {
+	case heatChanged && !coolChanged:
+		cr.SetCoolTemp(*cr.HeatTemp + delta)
+	case coolChanged && !heatChanged:
+		cr.SetHeatTemp(*cr.CoolTemp - delta)
+	}
+}
@@ -0,0 +1,83 @@
+package thermostat_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mrm.dev/venstar/thermostat"
+	"go.mrm.dev/venstar/thermostat/thermostattest"
+)
+
+var fakeQueryInfo = thermostat.QueryInfo{
+	Name:          "Thermostat",
+	Mode:          thermostat.ModeAuto,
+	Fan:           0,
+	HeatTemp:      68,
+	CoolTemp:      74,
+	HeatTempMin:   35,
+	HeatTempMax:   90,
+	CoolTempMin:   35,
+	CoolTempMax:   99,
+	SetPointDelta: 4,
+}
+
+func TestModifyControls(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*thermostat.ControlRequest)
+		want   map[string]string
+	}{
+		{"preserves current values", func(cr *thermostat.ControlRequest) { cr.FanOn() },
+			map[string]string{"mode": "3", "fan": "1", "heattemp": "68", "cooltemp": "74"}},
+		{"cool only", func(cr *thermostat.ControlRequest) { cr.SetCoolTemp(76) },
+			map[string]string{"mode": "3", "fan": "0", "heattemp": "68", "cooltemp": "76"}},
+		{"cool adjusts heat", func(cr *thermostat.ControlRequest) { cr.SetCoolTemp(70) },
+			map[string]string{"mode": "3", "fan": "0", "heattemp": "66", "cooltemp": "70"}},
+		{"heat adjusts cool", func(cr *thermostat.ControlRequest) { cr.SetHeatTemp(72) },
+			map[string]string{"mode": "3", "fan": "0", "heattemp": "72", "cooltemp": "76"}},
+		{"mode change", func(cr *thermostat.ControlRequest) { cr.SetMode(int(thermostat.ModeHeat)) },
+			map[string]string{"mode": "1", "fan": "0", "heattemp": "68", "cooltemp": "74"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := thermostattest.NewServer(t, fakeQueryInfo)
+			tstat := fake.Thermostat()
+			if err := tstat.ModifyControls(context.Background(), test.modify); err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			got := fake.LastUpdate()
+			for key, want := range test.want {
+				if got.Get(key) != want {
+					t.Error(key, "invalid, got:", got.Get(key), "want:", want)
+				}
+			}
+		})
+	}
+	t.Run("both changed are validated", func(t *testing.T) {
+		fake := thermostattest.NewServer(t, fakeQueryInfo)
+		tstat := fake.Thermostat()
+		err := tstat.ModifyControls(context.Background(), func(cr *thermostat.ControlRequest) {
+			cr.SetHeatTemp(72).SetCoolTemp(73)
+		})
+		if !errors.Is(err, thermostat.ErrValidation) {
+			t.Fatal("error invalid, got:", err, "want:", thermostat.ErrValidation)
+		}
+		if fake.LastUpdate() != nil {
+			t.Error("invalid update unexpectedly sent")
+		}
+	})
+	t.Run("query errors get returned", func(t *testing.T) {
+		down := httptest.NewServer(http.NotFoundHandler())
+		t.Cleanup(down.Close)
+		tstat := thermostat.New(strings.TrimPrefix(down.URL, "http://"), thermostat.WithRetryPolicy(thermostat.RetryPolicy{MaxAttempts: 1}))
+		err := tstat.ModifyControls(context.Background(), func(cr *thermostat.ControlRequest) {})
+		want := "modifying controls: processing query info request: /query/info request failed: status 404 Not Found: 404 page not found"
+		if err == nil || err.Error() != want {
+			t.Error("error invalid, got:", err, "want:", want)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package thermostat
+
+import (
+	"net/url"
+	"time"
+)
+
+// Option configures a Thermostat created with New.
+type Option func(*Thermostat)
+
+// WithHTTPClient sets the client used to send requests to the thermostat.
+// This allows for custom transports, proxies and instrumentation.
+func WithHTTPClient(client HTTPClient) Option {
+	return func(t *Thermostat) {
+		t.client = client
+	}
+}
+
+// WithTimeout sets the timeout applied to each request. A zero value disables
+// the timeout, leaving it to the context or http client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *Thermostat) {
+		t.timeout = timeout
+	}
+}
+
+// WithScheme sets the url scheme used to connect to the thermostat.
+// Defaults to http.
+func WithScheme(scheme string) Option {
+	return func(t *Thermostat) {
+		t.baseURL.Scheme = scheme
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with each request.
+func WithUserAgent(ua string) Option {
+	return func(t *Thermostat) {
+		t.userAgent = ua
+	}
+}
+
+// WithPin sets the unlock pin when device has a pin set.
+func WithPin(pin string) Option {
+	return func(t *Thermostat) {
+		t.pin = pin
+	}
+}
+
+// WithCapabilities sets the capabilities update requests are checked against
+// before being sent, see SetCapabilities and DetectCapabilities.
+func WithCapabilities(c *Capabilities) Option {
+	return func(t *Thermostat) {
+		t.capabilities = c
+	}
+}
+
+// WithBaseURL replaces the scheme, host and path prefix used to connect to the
+// thermostat, ignoring the host provided to New.
+func WithBaseURL(u *url.URL) Option {
+	return func(t *Thermostat) {
+		t.baseURL = *u
+	}
+}
+
+// WithCredentials sets the username and password used to answer Basic and
+// Digest authentication challenges issued by the thermostat.
+func WithCredentials(username, password string) Option {
+	return func(t *Thermostat) {
+		t.username = username
+		t.password = password
+	}
+}
+
+// WithCertificateFingerprint pins the thermostat's self-signed certificate by
+// its hex encoded SHA-256 fingerprint, see CertificateFingerprint. Use with
+// WithScheme("https"). It has no effect when WithHTTPClient is provided.
+func WithCertificateFingerprint(fingerprint string) Option {
+	return func(t *Thermostat) {
+		t.fingerprint = fingerprint
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests, replacing
+// DefaultRetryPolicy. A zero RetryPolicy disables retries.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(t *Thermostat) {
+		t.retryPolicy = &policy
+	}
+}
+
+// WithVerify enables verifying updates. After the thermostat accepts an
+// update, the query info is polled until the requested values are reflected,
+// returning a VerifyError listing the fields which did not take once the
+// policy timeout expires. Unset policy fields use DefaultVerifyPolicy.
+func WithVerify(policy VerifyPolicy) Option {
+	return func(t *Thermostat) {
+		t.verifyPolicy = &policy
+	}
+}
+
+// WithDryRun prevents updates from being sent to the thermostat. Updates are
+// still checked and validated, then rendered as a Plan and passed to fn in
+// place of being sent. fn may be nil to discard the plans. Queries are sent
+// as usual.
+func WithDryRun(fn func(*Plan)) Option {
+	return func(t *Thermostat) {
+		t.dryRun = true
+		t.onPlan = fn
+	}
+}
+
+// WithMaxInFlight sets the maximum number of requests sent to the thermostat
+// at once. Defaults to 1, serializing requests. Values less than 1 remove the
+// limit.
+func WithMaxInFlight(n int) Option {
+	return func(t *Thermostat) {
+		t.maxInFlight = n
+	}
+}
+
+// WithMinInterval sets the minimum time between the start of requests sent to
+// the thermostat, including retries.
+func WithMinInterval(interval time.Duration) Option {
+	return func(t *Thermostat) {
+		t.minInterval = interval
+	}
+}
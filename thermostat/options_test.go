@@ -0,0 +1,167 @@
+package thermostat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type recordingClient struct {
+	fakeThermostatClient
+	requests []*http.Request
+}
+
+func (c *recordingClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req)
+	return c.fakeThermostatClient.Do(req)
+}
+
+func TestNewDefaults(t *testing.T) {
+	tstat := New("127.0.0.1")
+	if _, ok := tstat.client.(*http.Client); !ok {
+		t.Errorf("client: got %T want *http.Client", tstat.client)
+	}
+	if tstat.timeout != defaultTimeout {
+		t.Error("timeout: got", tstat.timeout, "want", defaultTimeout)
+	}
+	if tstat.userAgent != userAgent {
+		t.Error("userAgent: got", tstat.userAgent, "want", userAgent)
+	}
+	want := "http://127.0.0.1/query/info"
+	if got := tstat.url("/query/info"); got != want {
+		t.Error("url: got", got, "want", want)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	client := &recordingClient{fakeThermostatClient: fakeThermostatClient{body: `{}`}}
+	tstat := New("127.0.0.1", WithHTTPClient(client))
+	if _, err := tstat.GetAPIInfo(); err != nil {
+		t.Fatal("error unexpected, got:", err)
+	}
+	if len(client.requests) != 1 {
+		t.Fatal("requests: got", len(client.requests), "want 1")
+	}
+	want := "http://127.0.0.1/"
+	if got := client.requests[0].URL.String(); got != want {
+		t.Error("url: got", got, "want", want)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	t.Run("deadline applied", func(t *testing.T) {
+		client := &recordingClient{fakeThermostatClient: fakeThermostatClient{body: `{}`}}
+		tstat := New("127.0.0.1", WithHTTPClient(client), WithTimeout(time.Minute))
+		if _, err := tstat.GetAPIInfo(); err != nil {
+			t.Fatal("error unexpected, got:", err)
+		}
+		deadline, ok := client.requests[0].Context().Deadline()
+		if !ok {
+			t.Fatal("request deadline not set")
+		}
+		if time.Until(deadline) > time.Minute {
+			t.Error("deadline too far out:", deadline)
+		}
+	})
+	t.Run("zero disables", func(t *testing.T) {
+		client := &recordingClient{fakeThermostatClient: fakeThermostatClient{body: `{}`}}
+		tstat := New("127.0.0.1", WithHTTPClient(client), WithTimeout(0))
+		if _, err := tstat.GetAPIInfo(); err != nil {
+			t.Fatal("error unexpected, got:", err)
+		}
+		if _, ok := client.requests[0].Context().Deadline(); ok {
+			t.Error("request deadline set, want none")
+		}
+	})
+}
+
+func TestWithScheme(t *testing.T) {
+	tstat := New("127.0.0.1", WithScheme("https"))
+	want := "https://127.0.0.1/"
+	if got := tstat.url("/"); got != want {
+		t.Error("url: got", got, "want", want)
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	want := "custom-agent/1.0"
+	tstat := New("127.0.0.1", WithUserAgent(want))
+	req, err := tstat.buildRequest(context.Background(), "GET", "http://localhost", nil)
+	if err != nil {
+		t.Fatal("returned error when none was expected:", err)
+	}
+	if got := req.Header.Get("User-Agent"); got != want {
+		t.Error("User-Agent: got", got, "want", want)
+	}
+}
+
+func TestWithPin(t *testing.T) {
+	want := "1597"
+	tstat := New("127.0.0.1", WithPin(want))
+	if tstat.pin != want {
+		t.Error("pin: got", tstat.pin, "want", want)
+	}
+}
+
+func TestWithBaseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		path string
+		want string
+	}{
+		{"root", "https://proxy.local", "/", "https://proxy.local/"},
+		{"no prefix", "https://proxy.local", "/query/info", "https://proxy.local/query/info"},
+		{"prefix", "https://proxy.local/tstat", "/query/info", "https://proxy.local/tstat/query/info"},
+		{"prefix trailing slash", "https://proxy.local/tstat/", "/query/info", "https://proxy.local/tstat/query/info"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.base)
+			if err != nil {
+				t.Fatal("parsing base url:", err)
+			}
+			tstat := New("127.0.0.1", WithBaseURL(u))
+			if got := tstat.url(test.path); got != test.want {
+				t.Error("url: got", got, "want", test.want)
+			}
+		})
+	}
+}
+
+func TestBaseURLUpdateEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"error": true, "reason": "bad reason"}`)
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL + "/tstat")
+	if err != nil {
+		t.Fatal("parsing base url:", err)
+	}
+	tstat := New("127.0.0.1", WithBaseURL(u))
+	tests := []struct {
+		name   string
+		update func() error
+		want   string
+	}{
+		{"controls", func() error { return tstat.UpdateControls(NewControlRequest().FanOn()) }, "/tstat/control"},
+		{"settings", func() error { return tstat.UpdateSettings(NewSettingsRequest().Away()) }, "/tstat/settings"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var apiErr *APIError
+			if err := test.update(); !errors.As(err, &apiErr) {
+				t.Fatal("error type invalid, got:", err, "want: *APIError")
+			}
+			if apiErr.Endpoint != test.want {
+				t.Error("Endpoint invalid, got:", apiErr.Endpoint, "want:", test.want)
+			}
+		})
+	}
+}
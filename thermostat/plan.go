@@ -0,0 +1,90 @@
+package thermostat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Plan is an update request rendered exactly as it would be sent to the
+// thermostat.
+type Plan struct {
+	Method string
+	URL    string
+	Header http.Header
+	// Body is the form encoded request body, including the pin when set.
+	Body string
+}
+
+// String returns the method, url and body of the request with the pin
+// redacted, suitable for logging.
+func (p *Plan) String() string {
+	body := p.Body
+	if params, err := url.ParseQuery(body); err == nil && params.Has("pin") {
+		params.Set("pin", "REDACTED")
+		body = params.Encode()
+	}
+	return p.Method + " " + p.URL + " " + body
+}
+
+// PlanControls validates the control request and renders it without sending
+// it to the thermostat.
+func (t *Thermostat) PlanControls(cr *ControlRequest) (*Plan, error) {
+	if err := t.checkControls(cr); err != nil {
+		return nil, fmt.Errorf("planning update control request: %w", err)
+	}
+	plan, err := t.plan(context.Background(), t.url("/control"), cr)
+	if err != nil {
+		return nil, fmt.Errorf("planning update control request: %w", err)
+	}
+	return plan, nil
+}
+
+// PlanSettings validates the settings request and renders it without sending
+// it to the thermostat.
+func (t *Thermostat) PlanSettings(sr *SettingsRequest) (*Plan, error) {
+	if err := t.checkSettings(sr); err != nil {
+		return nil, fmt.Errorf("planning update settings request: %w", err)
+	}
+	plan, err := t.plan(context.Background(), t.url("/settings"), sr)
+	if err != nil {
+		return nil, fmt.Errorf("planning update settings request: %w", err)
+	}
+	return plan, nil
+}
+
+func (t *Thermostat) plan(ctx context.Context, path string, update updateObject) (*Plan, error) {
+	req, err := t.buildUpdate(ctx, path, update)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s body: %w", path, err)
+		}
+	}
+	return &Plan{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header,
+		Body:   string(body),
+	}, nil
+}
+
+// dryRunUpdate plans the update and passes it to the dry run function in
+// place of sending it.
+func (t *Thermostat) dryRunUpdate(ctx context.Context, path string, update updateObject) error {
+	plan, err := t.plan(ctx, path, update)
+	if err != nil {
+		return err
+	}
+	if t.onPlan != nil {
+		t.onPlan(plan)
+	}
+	return nil
+}
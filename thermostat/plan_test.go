@@ -0,0 +1,107 @@
+package thermostat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlanUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		plan    func(*Thermostat) (*Plan, error)
+		url     string
+		body    string
+		display string
+	}{
+		{"controls", func(tstat *Thermostat) (*Plan, error) {
+			return tstat.PlanControls(NewControlRequest().SetUnits(Celsius).Heat(21, 23.5))
+		}, "http://127.0.0.1/control", "cooltemp=23.5&heattemp=21&mode=1&pin=1597",
+			"POST http://127.0.0.1/control cooltemp=23.5&heattemp=21&mode=1&pin=REDACTED"},
+		{"settings", func(tstat *Thermostat) (*Plan, error) {
+			return tstat.PlanSettings(NewSettingsRequest().Away().SetHumidifySetPoint(40))
+		}, "http://127.0.0.1/settings", "away=1&hum_setpoint=40&pin=1597",
+			"POST http://127.0.0.1/settings away=1&hum_setpoint=40&pin=REDACTED"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &recordingClient{}
+			tstat := New("127.0.0.1", WithHTTPClient(client), WithPin("1597"))
+			plan, err := test.plan(tstat)
+			if err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			if plan.Method != "POST" {
+				t.Error("Method invalid, got:", plan.Method, "want: POST")
+			}
+			if plan.URL != test.url {
+				t.Error("URL invalid, got:", plan.URL, "want:", test.url)
+			}
+			if plan.Body != test.body {
+				t.Error("Body invalid, got:", plan.Body, "want:", test.body)
+			}
+			if got := plan.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+				t.Error("Content-Type invalid, got:", got)
+			}
+			if got := plan.String(); got != test.display {
+				t.Error("String invalid, got:", got, "want:", test.display)
+			}
+			if len(client.requests) != 0 {
+				t.Error("requests unexpectedly sent, got:", len(client.requests))
+			}
+		})
+	}
+	t.Run("validation errors get returned", func(t *testing.T) {
+		tstat := New("127.0.0.1")
+		_, err := tstat.PlanControls(NewControlRequest().SetMode(1))
+		if !errors.Is(err, ErrValidation) {
+			t.Error("error invalid, got:", err, "want:", ErrValidation)
+		}
+	})
+	t.Run("capability errors get returned", func(t *testing.T) {
+		tstat := New("127.0.0.1", WithCapabilities(&Capabilities{Type: TypeCommercial}))
+		_, err := tstat.PlanSettings(NewSettingsRequest().Away())
+		if !errors.Is(err, ErrUnsupported) {
+			t.Error("error invalid, got:", err, "want:", ErrUnsupported)
+		}
+	})
+}
+
+func TestWithDryRun(t *testing.T) {
+	client := &recordingClient{fakeThermostatClient: fakeThermostatClient{body: `{"success": true}`}}
+	var plans []*Plan
+	tstat := New("127.0.0.1", WithHTTPClient(client), WithDryRun(func(p *Plan) {
+		plans = append(plans, p)
+	}))
+
+	if err := tstat.UpdateControls(NewControlRequest().FanOn()); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if err := tstat.UpdateSettings(NewSettingsRequest().ScheduleOff()); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if err := tstat.UpdateControls(NewControlRequest().SetMode(7)); !errors.Is(err, ErrValidation) {
+		t.Error("error invalid, got:", err, "want:", ErrValidation)
+	}
+	if len(client.requests) != 0 {
+		t.Error("requests unexpectedly sent, got:", len(client.requests))
+	}
+	want := []string{
+		"POST http://127.0.0.1/control fan=1",
+		"POST http://127.0.0.1/settings schedule=0",
+	}
+	if len(plans) != len(want) {
+		t.Fatal("plans invalid, got:", plans, "want:", want)
+	}
+	for i, plan := range plans {
+		if plan.String() != want[i] {
+			t.Error("plan invalid, got:", plan.String(), "want:", want[i])
+		}
+	}
+
+	if _, err := tstat.GetQueryInfo(); err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if len(client.requests) != 1 {
+		t.Error("queries not sent, got:", len(client.requests), "want:", 1)
+	}
+}
@@ -1,6 +1,7 @@
 package thermostat
 
 import (
+	"math"
 	"time"
 )
 
@@ -38,6 +39,14 @@ type QueryInfo struct {
 // Mode allows for a string representation of the value to be returned.
 type Mode int
 
+// Thermostat modes.
+const (
+	ModeOff  Mode = 0
+	ModeHeat Mode = 1
+	ModeCool Mode = 2
+	ModeAuto Mode = 3
+)
+
 // String returns a string representation of the value.
 func (m Mode) String() string {
 	switch m {
@@ -104,6 +113,12 @@ func (f FanState) String() string {
 // TempUnits allows for a string representation of the value to be returned.
 type TempUnits int
 
+// Temperature units.
+const (
+	Fahrenheit TempUnits = 0
+	Celsius    TempUnits = 1
+)
+
 // String returns a string representation of the value.
 func (f TempUnits) String() string {
 	switch f {
@@ -115,6 +130,21 @@ func (f TempUnits) String() string {
 	return ""
 }
 
+// Increment returns the smallest set point increment the thermostat accepts
+// in the units, whole degrees for fahrenheit and half degrees for celsius.
+func (f TempUnits) Increment() float64 {
+	if f == Celsius {
+		return 0.5
+	}
+	return 1
+}
+
+// Round rounds the temperature to the nearest set point increment.
+func (f TempUnits) Round(temp float64) float64 {
+	inc := f.Increment()
+	return math.Round(temp/inc) * inc
+}
+
 // Schedule allows for a string representation of the value to be returned.
 type Schedule int
 
@@ -248,3 +278,19 @@ func (f AvailableModes) String() string {
 	}
 	return ""
 }
+
+// Supports reports whether the mode is one of the available modes. Off is
+// always available.
+func (f AvailableModes) Supports(mode Mode) bool {
+	switch mode {
+	case ModeOff:
+		return true
+	case ModeHeat:
+		return f == 0 || f == 1 || f == 2
+	case ModeCool:
+		return f == 0 || f == 1 || f == 3
+	case ModeAuto:
+		return f == 0
+	}
+	return false
+}
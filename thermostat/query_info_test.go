@@ -274,6 +274,32 @@ func TestTempUnitsString(t *testing.T) {
 	}
 }
 
+func TestTempUnitsRound(t *testing.T) {
+	tests := []struct {
+		name  string
+		units TempUnits
+		value float64
+		want  float64
+	}{
+		{"fahrenheit whole", Fahrenheit, 72, 72},
+		{"fahrenheit down", Fahrenheit, 72.4, 72},
+		{"fahrenheit up", Fahrenheit, 72.5, 73},
+		{"celsius whole", Celsius, 21, 21},
+		{"celsius half", Celsius, 21.5, 21.5},
+		{"celsius down", Celsius, 21.2, 21},
+		{"celsius up to half", Celsius, 21.3, 21.5},
+		{"celsius up", Celsius, 21.8, 22},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.units.Round(test.value)
+			if got != test.want {
+				t.Error("unexpected rounding for value", test.value, "got:", got, "want:", test.want)
+			}
+		})
+	}
+}
+
 func TestScheduleString(t *testing.T) {
 	tests := []struct {
 		name  string
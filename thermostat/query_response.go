@@ -17,6 +17,10 @@ type QueryResponse struct {
 type Sensor struct {
 	Name string  `json:"name"`
 	Temp float64 `json:"temp"`
+	// Units are the thermostat's TempUnits the reading is in, or nil when
+	// unknown. The sensors response does not include the units, so they are
+	// only set by Snapshot from the query info retreived alongside.
+	Units *TempUnits `json:"-"`
 }
 
 // Alert represents the thermostat alert values
@@ -0,0 +1,139 @@
+package thermostat
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// DefaultRetryPolicy is the retry policy used by New. Requests retreiving
+// information are attempted up to 3 times, updates are not retried.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Jitter:         0.2,
+}
+
+// RetryPolicy controls how failed requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made for a request,
+	// including the first. Values less than 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubling for each
+	// retry after.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries. Zero means no cap.
+	MaxBackoff time.Duration
+	// Jitter randomizes each delay by up to the provided fraction (0-1) of
+	// the delay.
+	Jitter float64
+	// RetryUpdates enables retrying UpdateControls and UpdateSettings.
+	// Updates are not retried by default as a failed response does not
+	// guarantee the thermostat did not apply the update.
+	RetryUpdates bool
+	// Retryable reports whether a failed attempt should be retried.
+	// Defaults to IsRetryable.
+	Retryable func(error) bool
+	// OnRetry, when set, is called before each retry with the number of the
+	// attempt which failed and its error.
+	OnRetry func(attempt int, err error)
+}
+
+// attempts returns the maximum attempts allowed for a request.
+func (p *RetryPolicy) attempts(update bool) int {
+	if p == nil || p.MaxAttempts < 1 || (update && !p.RetryUpdates) {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the delay to wait after the provided attempt failed.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	return time.Duration(delay)
+}
+
+// retryableStatuses are the response statuses which are worth retrying.
+var retryableStatuses = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying.
+// Network errors, timeouts and 408, 429, 500, 502, 503 and 504 responses are
+// retryable. Validation, decoding, certificate and thermostat rejections are
+// not.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrValidation) || errors.Is(err, ErrDecode) || errors.Is(err, ErrResponseTooLarge) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatuses[apiErr.StatusCode]
+	}
+	var certErr *tls.CertificateVerificationError
+	return !errors.As(err, &certErr)
+}
+
+// RetryError is returned when a request failed after being retried.
+type RetryError struct {
+	// Attempts is the number of attempts made.
+	Attempts int
+	// Err is the error from the last attempt.
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (after %d attempts)", e.Err, e.Attempts)
+}
+
+// Unwrap returns the error from the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// sleepContext waits for the provided duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,236 @@
+package thermostat
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sequenceClient responds with each of the provided responses in turn,
+// repeating the last one once exhausted.
+type sequenceClient struct {
+	responses []fakeThermostatClient
+	calls     int
+	bodies    []string
+}
+
+func (c *sequenceClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		c.bodies = append(c.bodies, string(body))
+	}
+	resp := c.responses[min(c.calls, len(c.responses)-1)]
+	c.calls++
+	return resp.Do(req)
+}
+
+func testRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+}
+
+func TestRetryGet(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []fakeThermostatClient
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", []fakeThermostatClient{{body: `{}`}}, 1, false},
+		{"network error then success", []fakeThermostatClient{{error: true}, {body: `{}`}}, 2, false},
+		{"503 then success", []fakeThermostatClient{{status: 503}, {status: 500}, {body: `{}`}}, 3, false},
+		{"exhausted", []fakeThermostatClient{{error: true}}, 3, true},
+		{"not found not retried", []fakeThermostatClient{{status: 404}}, 1, true},
+		{"decode error not retried", []fakeThermostatClient{{body: `invalid`}}, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &sequenceClient{responses: test.responses}
+			var retries []int
+			policy := testRetryPolicy()
+			policy.OnRetry = func(attempt int, _ error) {
+				retries = append(retries, attempt)
+			}
+			tstat := &Thermostat{client: client, retryPolicy: policy}
+			_, err := tstat.GetQueryInfo()
+			if test.wantErr != (err != nil) {
+				t.Fatal("error unexpected, got:", err, "want error:", test.wantErr)
+			}
+			if client.calls != test.wantCalls {
+				t.Error("calls, got:", client.calls, "want:", test.wantCalls)
+			}
+			if len(retries) != test.wantCalls-1 {
+				t.Error("OnRetry calls, got:", retries, "want:", test.wantCalls-1)
+			}
+			var retryErr *RetryError
+			isRetryErr := errors.As(err, &retryErr)
+			if isRetryErr != (err != nil && test.wantCalls > 1) {
+				t.Fatal("RetryError unexpected, got:", err)
+			}
+			if isRetryErr && retryErr.Attempts != test.wantCalls {
+				t.Error("Attempts, got:", retryErr.Attempts, "want:", test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryUpdates(t *testing.T) {
+	responses := []fakeThermostatClient{{status: 503}, {body: `{"success": true}`}}
+	t.Run("not retried by default", func(t *testing.T) {
+		client := &sequenceClient{responses: responses}
+		tstat := &Thermostat{client: client, retryPolicy: testRetryPolicy()}
+		err := tstat.UpdateControls(NewControlRequest().FanOn())
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 503 {
+			t.Fatal("error invalid, got:", err, "want: 503 *APIError")
+		}
+		if client.calls != 1 {
+			t.Error("calls, got:", client.calls, "want: 1")
+		}
+	})
+	t.Run("retried when enabled", func(t *testing.T) {
+		client := &sequenceClient{responses: responses}
+		policy := testRetryPolicy()
+		policy.RetryUpdates = true
+		tstat := &Thermostat{client: client, retryPolicy: policy, pin: "1234"}
+		if err := tstat.UpdateSettings(NewSettingsRequest().Away()); err != nil {
+			t.Fatal("error unexpected, got:", err)
+		}
+		if client.calls != 2 {
+			t.Error("calls, got:", client.calls, "want: 2")
+		}
+		for _, body := range client.bodies {
+			if body != "away=1&pin=1234" {
+				t.Error("body not rebuilt for retry, got:", body)
+			}
+		}
+	})
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	client := &sequenceClient{responses: []fakeThermostatClient{{error: true}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Hour,
+		OnRetry: func(int, error) {
+			cancel()
+		},
+	}
+	tstat := &Thermostat{client: client, retryPolicy: policy}
+	_, err := tstat.GetQueryInfoContext(ctx)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatal("error invalid, got:", err, "want: *RetryError")
+	}
+	if client.calls != 1 {
+		t.Error("calls, got:", client.calls, "want: 1")
+	}
+}
+
+func TestRetryCustomRetryable(t *testing.T) {
+	client := &sequenceClient{responses: []fakeThermostatClient{{status: 404}, {body: `{}`}}}
+	policy := testRetryPolicy()
+	policy.Retryable = func(err error) bool {
+		var apiErr *APIError
+		return errors.As(err, &apiErr) && apiErr.StatusCode == 404
+	}
+	tstat := &Thermostat{client: client, retryPolicy: policy}
+	if _, err := tstat.GetAPIInfo(); err != nil {
+		t.Fatal("error unexpected, got:", err)
+	}
+	if client.calls != 2 {
+		t.Error("calls, got:", client.calls, "want: 2")
+	}
+}
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *RetryPolicy
+		update bool
+		want   int
+	}{
+		{"nil", nil, false, 1},
+		{"zero", &RetryPolicy{}, false, 1},
+		{"get", &RetryPolicy{MaxAttempts: 3}, false, 3},
+		{"update", &RetryPolicy{MaxAttempts: 3}, true, 1},
+		{"update enabled", &RetryPolicy{MaxAttempts: 3, RetryUpdates: true}, true, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.attempts(test.update); got != test.want {
+				t.Error("attempts, got:", got, "want:", test.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := policy.backoff(i + 1); got != w {
+			t.Error("attempt", i+1, "backoff, got:", got, "want:", w)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := policy.backoff(2)
+		if got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatal("jittered backoff out of range, got:", got)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"network", errors.New("connection reset"), true},
+		{"deadline", fmt.Errorf("requesting: %w", context.DeadlineExceeded), true},
+		{"canceled", fmt.Errorf("requesting: %w", context.Canceled), false},
+		{"validation", &ValidationError{Field: "Mode"}, false},
+		{"decode", fmt.Errorf("%w: bad", ErrDecode), false},
+		{"too large", ErrResponseTooLarge, false},
+		{"503", &APIError{StatusCode: 503}, true},
+		{"429", &APIError{StatusCode: 429}, true},
+		{"404", &APIError{StatusCode: 404}, false},
+		{"rejected", &APIError{StatusCode: 200, Reason: "bad"}, false},
+		{"pin", &PinError{&APIError{StatusCode: 200, Reason: "Invalid PIN"}}, false},
+		{"certificate", &tls.CertificateVerificationError{Err: errors.New("bad cert")}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsRetryable(test.err); got != test.want {
+				t.Error("got:", got, "want:", test.want)
+			}
+		})
+	}
+}
+
+func TestRetryErrorError(t *testing.T) {
+	err := &RetryError{Attempts: 3, Err: errors.New("connection reset")}
+	want := "connection reset (after 3 attempts)"
+	if got := err.Error(); got != want {
+		t.Error("got:", got, "want:", want)
+	}
+	if !strings.Contains(fmt.Sprint(errors.Unwrap(err)), "connection reset") {
+		t.Error("Unwrap invalid")
+	}
+}
@@ -1,6 +1,7 @@
 package thermostat
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -16,6 +17,7 @@ type SettingsRequest struct {
 	Schedule           *int `json:"schedule,omitempty"`
 	HumidifySetPoint   *int `json:"hum_setpoint,omitempty"`
 	DehumidifySetPoint *int `json:"dehum_setpoint,omitempty"`
+	validator          func(*SettingsRequest) error
 }
 
 // SetTempUnits sets the temperature units 0:fahrenheit 1:celsius
@@ -88,8 +90,20 @@ func (sr *SettingsRequest) SetDehumidifySetPoint(value int) *SettingsRequest {
 	return sr
 }
 
+// Validate verifies the update request has compatible settings
+func (sr *SettingsRequest) Validate() error {
+	if sr.validator == nil {
+		return defaultSettingsRequestValidator(sr)
+	}
+	return sr.validator(sr)
+}
+
 // BuildRequest applys the necessary request changes to the provided request.
 func (sr *SettingsRequest) BuildRequest(req *http.Request) error {
+	err := sr.Validate()
+	if err != nil {
+		return err
+	}
 	params := make(url.Values)
 	if sr.TempUnits != nil {
 		params.Set("tempunits", strconv.Itoa(*sr.TempUnits))
@@ -113,7 +127,69 @@ func (sr *SettingsRequest) BuildRequest(req *http.Request) error {
 	return nil
 }
 
+// Documented humidity set point ranges.
+const (
+	minHumidifySetPoint   = 0
+	maxHumidifySetPoint   = 60
+	minDehumidifySetPoint = 25
+	maxDehumidifySetPoint = 99
+)
+
+func defaultSettingsRequestValidator(sr *SettingsRequest) error {
+	return checkSettingsRequest(sr).err()
+}
+
+// checkSettingsRequest verifies the settings are within their documented
+// ranges, returning each failing field.
+func checkSettingsRequest(sr *SettingsRequest) ValidationErrors {
+	var errs ValidationErrors
+	checkFlag := func(field string, value *int, off, on string) {
+		if value != nil && *value != 0 && *value != 1 {
+			errs = append(errs, &ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("%s must be 0 (%s) or 1 (%s), got %d", field, off, on, *value),
+			})
+		}
+	}
+	checkRange := func(field string, value *int, min, max int) {
+		if value != nil && (*value < min || *value > max) {
+			errs = append(errs, &ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("%s %d must be between %d and %d", field, *value, min, max),
+			})
+		}
+	}
+	checkFlag("TempUnits", sr.TempUnits, "fahrenheit", "celsius")
+	checkFlag("IsAway", sr.IsAway, "home", "away")
+	checkFlag("Schedule", sr.Schedule, "off", "on")
+	checkRange("HumidifySetPoint", sr.HumidifySetPoint, minHumidifySetPoint, maxHumidifySetPoint)
+	checkRange("DehumidifySetPoint", sr.DehumidifySetPoint, minDehumidifySetPoint, maxDehumidifySetPoint)
+	return errs
+}
+
 // NewSettingsRequest initializes a new SettingsRequest object
 func NewSettingsRequest() *SettingsRequest {
-	return &SettingsRequest{}
+	return &SettingsRequest{
+		validator: defaultSettingsRequestValidator,
+	}
+}
+
+// NewSettingsRequestFor initializes a new SettingsRequest object validated
+// against the thermostat's current state. In addition to the default checks,
+// humidity set points are rejected when humidity is disabled.
+func NewSettingsRequestFor(info *QueryInfo) *SettingsRequest {
+	return &SettingsRequest{
+		validator: func(sr *SettingsRequest) error {
+			errs := checkSettingsRequest(sr)
+			if info.HumidityEnabled == 0 {
+				if sr.HumidifySetPoint != nil {
+					errs = append(errs, &ValidationError{Field: "HumidifySetPoint", Message: "HumidifySetPoint cannot be set when humidity is disabled"})
+				}
+				if sr.DehumidifySetPoint != nil {
+					errs = append(errs, &ValidationError{Field: "DehumidifySetPoint", Message: "DehumidifySetPoint cannot be set when humidity is disabled"})
+				}
+			}
+			return errs.err()
+		},
+	}
 }
@@ -1,6 +1,7 @@
 package thermostat
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"testing"
@@ -24,7 +25,7 @@ func TestClientUpdateSettings(t *testing.T) {
 		}
 	})
 	t.Run("response errors get returned", func(t *testing.T) {
-		wantErr := `Settings Request update error: bad reason`
+		wantErr := `/settings request failed: bad reason`
 		tstat := &Thermostat{
 			client: &fakeThermostatClient{
 				body: `{"error": true, "reason": "bad reason"}`,
@@ -38,9 +39,16 @@ func TestClientUpdateSettings(t *testing.T) {
 		if err.Error() != wantErr {
 			t.Fatal("error invalid, got:", err.Error(), "want:", wantErr)
 		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatal("error type invalid, got:", err, "want: *APIError")
+		}
+		if apiErr.Endpoint != "/settings" || apiErr.Reason != "bad reason" {
+			t.Errorf("APIError invalid, got: %+v", apiErr)
+		}
 	})
 	t.Run("unknown errors captured", func(t *testing.T) {
-		wantErr := `Settings Request unknown error`
+		wantErr := `/settings request failed: unknown error`
 		tstat := &Thermostat{
 			client: &fakeThermostatClient{
 				body: `{"success": false}`,
@@ -226,6 +234,7 @@ func TestSettingsRequestBuildRequest(t *testing.T) {
 		errExp     string
 	}{
 		{"no error when empty", -1, -1, -1, -1, -1, 0, ""},
+		{"validation error returned", -1, -1, -1, -1, -1, -1, "validation error"},
 		{"units", 0, -1, -1, -1, -1, 11, ""},
 		{"units,away", 0, 1, -1, -1, -1, 18, ""},
 		{"units,away,schedule", 0, 1, 2, -1, -1, 29, ""},
@@ -250,6 +259,14 @@ func TestSettingsRequestBuildRequest(t *testing.T) {
 			if test.dehumidify != -1 {
 				cr.SetDehumidifySetPoint(test.dehumidify)
 			}
+			validateCalled := false
+			cr.validator = func(_ *SettingsRequest) error {
+				validateCalled = true
+				if test.wantLen == -1 {
+					return errors.New("validation error")
+				}
+				return nil
+			}
 			req := &http.Request{
 				Header: make(http.Header),
 			}
@@ -271,6 +288,9 @@ func TestSettingsRequestBuildRequest(t *testing.T) {
 			if err != nil {
 				t.Fatal("Unexpected body read error:", err)
 			}
+			if !validateCalled {
+				t.Error("Validate not called")
+			}
 			if len(body) != test.wantLen {
 				t.Error("Body length invalid, got:", string(body))
 			}
@@ -280,3 +300,105 @@ func TestSettingsRequestBuildRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestSettingsRequestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		units      int
+		away       int
+		schedule   int
+		humidify   int
+		dehumidify int
+		errExp     string
+	}{
+		{"no error when empty", -1, -1, -1, -1, -1, ""},
+		{"all valid", 1, 1, 0, 40, 60, ""},
+		{"units invalid", 2, -1, -1, -1, -1, "TempUnits must be 0 (fahrenheit) or 1 (celsius), got 2"},
+		{"away invalid", -1, 3, -1, -1, -1, "IsAway must be 0 (home) or 1 (away), got 3"},
+		{"schedule invalid", -1, -1, 2, -1, -1, "Schedule must be 0 (off) or 1 (on), got 2"},
+		{"humidify min", -1, -1, -1, 0, -1, ""},
+		{"humidify max", -1, -1, -1, 60, -1, ""},
+		{"humidify above max", -1, -1, -1, 61, -1, "HumidifySetPoint 61 must be between 0 and 60"},
+		{"dehumidify min", -1, -1, -1, -1, 25, ""},
+		{"dehumidify below min", -1, -1, -1, -1, 24, "DehumidifySetPoint 24 must be between 25 and 99"},
+		{"dehumidify above max", -1, -1, -1, -1, 100, "DehumidifySetPoint 100 must be between 25 and 99"},
+		{"multiple fields", 5, -1, -1, 70, 10, "TempUnits must be 0 (fahrenheit) or 1 (celsius), got 5; HumidifySetPoint 70 must be between 0 and 60; DehumidifySetPoint 10 must be between 25 and 99"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sr := NewSettingsRequest()
+			if test.units != -1 {
+				sr.SetTempUnits(test.units)
+			}
+			if test.away != -1 {
+				sr.IsAway = &test.away
+			}
+			if test.schedule != -1 {
+				sr.SetSchedule(test.schedule)
+			}
+			if test.humidify != -1 {
+				sr.SetHumidifySetPoint(test.humidify)
+			}
+			if test.dehumidify != -1 {
+				sr.SetDehumidifySetPoint(test.dehumidify)
+			}
+			err := sr.Validate()
+			if test.errExp == "" {
+				if err != nil {
+					t.Fatal("Error invalid, got:", err.Error(), "want: nil")
+				}
+				return
+			}
+			if err == nil || err.Error() != test.errExp {
+				t.Fatal("Error invalid, got:", err, "want:", test.errExp)
+			}
+			if !errors.Is(err, ErrValidation) {
+				t.Error("Error does not match ErrValidation, got:", err)
+			}
+		})
+	}
+	t.Run("zero value uses default validator", func(t *testing.T) {
+		sr := &SettingsRequest{}
+		sr.SetSchedule(2)
+		if err := sr.Validate(); !errors.Is(err, ErrValidation) {
+			t.Error("Error invalid, got:", err, "want:", ErrValidation)
+		}
+	})
+}
+
+func TestNewSettingsRequestFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled HumidityEnabled
+		update  func(*SettingsRequest)
+		errExp  string
+	}{
+		{"humidity enabled", 1, func(sr *SettingsRequest) { sr.SetHumidifySetPoint(40).SetDehumidifySetPoint(60) }, ""},
+		{"humidity disabled", 0, func(sr *SettingsRequest) { sr.SetHumidifySetPoint(40).SetDehumidifySetPoint(60) },
+			"HumidifySetPoint cannot be set when humidity is disabled; DehumidifySetPoint cannot be set when humidity is disabled"},
+		{"humidity disabled, other settings", 0, func(sr *SettingsRequest) { sr.Celsius().ScheduleOn() }, ""},
+		{"default checks applied", 1, func(sr *SettingsRequest) { sr.SetHumidifySetPoint(61) },
+			"HumidifySetPoint 61 must be between 0 and 60"},
+		{"default and humidity checks combined", 0, func(sr *SettingsRequest) { sr.SetTempUnits(3).SetDehumidifySetPoint(60) },
+			"TempUnits must be 0 (fahrenheit) or 1 (celsius), got 3; DehumidifySetPoint cannot be set when humidity is disabled"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sr := NewSettingsRequestFor(&QueryInfo{HumidityEnabled: test.enabled})
+			test.update(sr)
+			err := sr.Validate()
+			if test.errExp == "" {
+				if err != nil {
+					t.Fatal("Error invalid, got:", err.Error(), "want: nil")
+				}
+				return
+			}
+			if err == nil || err.Error() != test.errExp {
+				t.Fatal("Error invalid, got:", err, "want:", test.errExp)
+			}
+			if !errors.Is(err, ErrValidation) {
+				t.Error("Error does not match ErrValidation, got:", err)
+			}
+		})
+	}
+}
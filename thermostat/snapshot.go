@@ -0,0 +1,125 @@
+package thermostat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Section identifies a part of a Snapshot.
+type Section string
+
+// Sections of a Snapshot, in the order they are reported.
+const (
+	SectionAPIInfo   Section = "api info"
+	SectionQueryInfo Section = "query info"
+	SectionSensors   Section = "query sensors"
+	SectionRuntimes  Section = "query runtimes"
+	SectionAlerts    Section = "query alerts"
+)
+
+var snapshotSections = []Section{
+	SectionAPIInfo,
+	SectionQueryInfo,
+	SectionSensors,
+	SectionRuntimes,
+	SectionAlerts,
+}
+
+// Snapshot combines all information available from the thermostat.
+// Sections which failed to be retreived are nil and have their error recorded
+// in Errors.
+type Snapshot struct {
+	// FetchedAt is when all sections finished being retreived.
+	FetchedAt time.Time
+	APIInfo   *APIInfo
+	QueryInfo *QueryInfo
+	Sensors   []*Sensor
+	Runtimes  []*Runtime
+	Alerts    []*Alert
+	// Errors holds the error for each section which failed.
+	Errors map[Section]error
+}
+
+// Err returns the errors of all failed sections joined together, or nil if
+// every section was retreived.
+func (s *Snapshot) Err() error {
+	var errs []error
+	for _, section := range snapshotSections {
+		if err := s.Errors[section]; err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", section, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Snapshot retreives the api info, query info, sensors, runtimes and alerts
+// from the thermostat concurrently, subject to the request limits of the
+// Thermostat. A Snapshot is always returned, holding every section which was
+// retreived. The returned error is Snapshot.Err.
+func (t *Thermostat) Snapshot(ctx context.Context) (*Snapshot, error) {
+	return t.SnapshotSections(ctx, snapshotSections...)
+}
+
+// SnapshotSections is like Snapshot but only retreives the given sections,
+// leaving the others nil. Unknown and repeated sections are ignored.
+func (t *Thermostat) SnapshotSections(ctx context.Context, sections ...Section) (*Snapshot, error) {
+	snap := &Snapshot{
+		Errors: make(map[Section]error),
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	// Each func only assigns its own section, so only Errors requires locking.
+	fetchers := map[Section]func() error{
+		SectionAPIInfo: func() (err error) {
+			snap.APIInfo, err = t.GetAPIInfoContext(ctx)
+			return err
+		},
+		SectionQueryInfo: func() (err error) {
+			snap.QueryInfo, err = t.GetQueryInfoContext(ctx)
+			return err
+		},
+		SectionSensors: func() (err error) {
+			snap.Sensors, err = t.GetQuerySensorsContext(ctx)
+			return err
+		},
+		SectionRuntimes: func() (err error) {
+			snap.Runtimes, err = t.GetQueryRuntimesContext(ctx)
+			return err
+		},
+		SectionAlerts: func() (err error) {
+			snap.Alerts, err = t.GetQueryAlertsContext(ctx)
+			return err
+		},
+	}
+	for _, section := range sections {
+		fn, ok := fetchers[section]
+		if !ok {
+			continue
+		}
+		delete(fetchers, section)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				mu.Lock()
+				snap.Errors[section] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// Sensors are fetched alongside the query info, which provides their units.
+	if snap.QueryInfo != nil {
+		units := snap.QueryInfo.TempUnits
+		for _, sensor := range snap.Sensors {
+			sensor.Units = &units
+		}
+	}
+	snap.FetchedAt = time.Now()
+	return snap, snap.Err()
+}
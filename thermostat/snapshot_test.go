@@ -0,0 +1,139 @@
+package thermostat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// routeClient responds based on the request path, failing any path listed in
+// fail. Responses are taken from bodies, falling back to routeBodies.
+type routeClient struct {
+	fail     map[string]bool
+	bodies   map[string]string
+	inFlight atomic.Int32
+	peak     atomic.Int32
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+// requested returns how many times path has been requested.
+func (c *routeClient) requested(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests[path]
+}
+
+var routeBodies = map[string]string{
+	"/":               `{"api_ver": 7, "type": "commercial"}`,
+	"/query/info":     `{"name": "Thermostat", "spacetemp": 74}`,
+	"/query/sensors":  `{"sensors": [{"name": "Thermostat", "temp": 74}]}`,
+	"/query/runtimes": `{"runtimes": [{"ts": 1600984738, "heat1": 10}]}`,
+	"/query/alerts":   `{"alerts": [{"name": "Air Filter", "active": true}]}`,
+}
+
+func (c *routeClient) Do(req *http.Request) (*http.Response, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	if n > c.peak.Load() {
+		c.peak.Store(n)
+	}
+	c.mu.Lock()
+	if c.requests == nil {
+		c.requests = make(map[string]int)
+	}
+	c.requests[req.URL.Path]++
+	c.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	if c.fail[req.URL.Path] {
+		return nil, errors.New("this is an error")
+	}
+	body, ok := c.bodies[req.URL.Path]
+	if !ok {
+		body = routeBodies[req.URL.Path]
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("all sections", func(t *testing.T) {
+		client := &routeClient{}
+		tstat := New("127.0.0.1", WithHTTPClient(client))
+		before := time.Now()
+		snap, err := tstat.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal("error unexpected, got:", err)
+		}
+		if snap.FetchedAt.Before(before) {
+			t.Error("FetchedAt invalid, got:", snap.FetchedAt)
+		}
+		if snap.APIInfo == nil || snap.APIInfo.Type != "commercial" {
+			t.Errorf("APIInfo invalid, got: %+v", snap.APIInfo)
+		}
+		if snap.QueryInfo == nil || snap.QueryInfo.Name != "Thermostat" {
+			t.Errorf("QueryInfo invalid, got: %+v", snap.QueryInfo)
+		}
+		if len(snap.Sensors) != 1 || len(snap.Runtimes) != 1 || len(snap.Alerts) != 1 {
+			t.Error("sections missing, got:", len(snap.Sensors), len(snap.Runtimes), len(snap.Alerts))
+		}
+		if len(snap.Errors) != 0 {
+			t.Error("Errors unexpected, got:", snap.Errors)
+		}
+		if peak := client.peak.Load(); peak != 1 {
+			t.Error("limiter not respected, peak in flight:", peak)
+		}
+	})
+	t.Run("partial failure", func(t *testing.T) {
+		client := &routeClient{fail: map[string]bool{"/query/sensors": true, "/": true}}
+		tstat := &Thermostat{client: client}
+		snap, err := tstat.Snapshot(context.Background())
+		if err == nil {
+			t.Fatal("error expected but no error returned")
+		}
+		if snap == nil {
+			t.Fatal("snapshot not returned on partial failure")
+		}
+		want := "api info: processing api info request: requesting /: this is an error\n" +
+			"query sensors: processing query sensors request: requesting /query/sensors: this is an error"
+		if err.Error() != want {
+			t.Error("error invalid, got:", err.Error(), "want:", want)
+		}
+		if len(snap.Errors) != 2 || snap.Errors[SectionSensors] == nil || snap.Errors[SectionAPIInfo] == nil {
+			t.Error("Errors invalid, got:", snap.Errors)
+		}
+		if snap.APIInfo != nil || snap.Sensors != nil {
+			t.Error("failed sections populated")
+		}
+		if snap.QueryInfo == nil || snap.Runtimes == nil || snap.Alerts == nil {
+			t.Error("successful sections missing")
+		}
+	})
+}
+
+func TestSnapshotSections(t *testing.T) {
+	client := &routeClient{fail: map[string]bool{"/": true, "/query/runtimes": true}}
+	tstat := New("127.0.0.1", WithHTTPClient(client))
+	snap, err := tstat.SnapshotSections(context.Background(), SectionQueryInfo, SectionSensors, SectionSensors, Section("unknown"))
+	if err != nil {
+		t.Fatal("error unexpectedly returned: ", err)
+	}
+	if snap.QueryInfo == nil || len(snap.Sensors) != 1 {
+		t.Errorf("sections missing, got: %+v %v", snap.QueryInfo, snap.Sensors)
+	}
+	if snap.APIInfo != nil || snap.Runtimes != nil || snap.Alerts != nil {
+		t.Error("unrequested sections populated")
+	}
+	if len(snap.Errors) != 0 {
+		t.Error("Errors unexpected, got:", snap.Errors)
+	}
+}
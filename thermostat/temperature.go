@@ -0,0 +1,117 @@
+package thermostat
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Temperature is a temperature value along with the units it is in.
+type Temperature struct {
+	Value float64
+	Units TempUnits
+}
+
+// NewFahrenheit returns a Temperature in fahrenheit.
+func NewFahrenheit(value float64) Temperature {
+	return Temperature{Value: value, Units: Fahrenheit}
+}
+
+// NewCelsius returns a Temperature in celsius.
+func NewCelsius(value float64) Temperature {
+	return Temperature{Value: value, Units: Celsius}
+}
+
+// Fahrenheit returns the temperature value in fahrenheit.
+func (t Temperature) Fahrenheit() float64 {
+	if t.Units == Celsius {
+		return t.Value*9/5 + 32
+	}
+	return t.Value
+}
+
+// Celsius returns the temperature value in celsius.
+func (t Temperature) Celsius() float64 {
+	if t.Units == Celsius {
+		return t.Value
+	}
+	return (t.Value - 32) * 5 / 9
+}
+
+// In returns the temperature converted to the provided units.
+func (t Temperature) In(units TempUnits) Temperature {
+	if units == Celsius {
+		return NewCelsius(t.Celsius())
+	}
+	return NewFahrenheit(t.Fahrenheit())
+}
+
+// String returns the temperature rounded to a tenth of a degree along with
+// its unit symbol, such as `21.5°C`.
+func (t Temperature) String() string {
+	value := strconv.FormatFloat(math.Round(t.Value*10)/10, 'f', -1, 64)
+	if t.Units == Celsius {
+		return value + "°C"
+	}
+	return value + "°F"
+}
+
+// SpaceTemperature returns SpaceTemp in the thermostat's units.
+func (qi *QueryInfo) SpaceTemperature() Temperature {
+	return Temperature{Value: qi.SpaceTemp, Units: qi.TempUnits}
+}
+
+// HeatTemperature returns HeatTemp in the thermostat's units.
+func (qi *QueryInfo) HeatTemperature() Temperature {
+	return Temperature{Value: qi.HeatTemp, Units: qi.TempUnits}
+}
+
+// CoolTemperature returns CoolTemp in the thermostat's units.
+func (qi *QueryInfo) CoolTemperature() Temperature {
+	return Temperature{Value: qi.CoolTemp, Units: qi.TempUnits}
+}
+
+// Temperature returns the sensor reading in the thermostat's units. The
+// reading is only returned when the sensor Units are known.
+func (s *Sensor) Temperature() (Temperature, bool) {
+	if s.Units == nil {
+		return Temperature{}, false
+	}
+	return Temperature{Value: s.Temp, Units: *s.Units}, true
+}
+
+// SetHeatTemperature sets the heat to temperature, converting and rounding it
+// to the request units. The request units must be known, use
+// NewControlRequestFor or SetUnits beforehand, otherwise a ValidationError is
+// returned by Validate.
+func (cr *ControlRequest) SetHeatTemperature(temp Temperature) *ControlRequest {
+	value, ok := cr.convertTemp("HeatTemp", temp)
+	if !ok {
+		return cr
+	}
+	return cr.SetHeatTemp(value)
+}
+
+// SetCoolTemperature sets the cool to temperature, converting and rounding it
+// to the request units. See SetHeatTemperature.
+func (cr *ControlRequest) SetCoolTemperature(temp Temperature) *ControlRequest {
+	value, ok := cr.convertTemp("CoolTemp", temp)
+	if !ok {
+		return cr
+	}
+	return cr.SetCoolTemp(value)
+}
+
+// convertTemp converts the temperature to the request units. When the units
+// are unknown the temperature can't be converted, so a ValidationError for
+// the field is recorded instead.
+func (cr *ControlRequest) convertTemp(field string, temp Temperature) (float64, bool) {
+	if cr.units == nil {
+		cr.errs = append(cr.errs, &ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("%s %s can't be converted as the thermostat units are unknown", field, temp),
+		})
+		return 0, false
+	}
+	return cr.units.Round(temp.In(*cr.units).Value), true
+}
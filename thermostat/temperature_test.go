@@ -0,0 +1,161 @@
+package thermostat
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestTemperatureConversion(t *testing.T) {
+	tests := []struct {
+		name       string
+		temp       Temperature
+		fahrenheit float64
+		celsius    float64
+		str        string
+	}{
+		{"fahrenheit", NewFahrenheit(72), 72, 22.2222, "72°F"},
+		{"fahrenheit freezing", NewFahrenheit(32), 32, 0, "32°F"},
+		{"celsius", NewCelsius(21.5), 70.7, 21.5, "21.5°C"},
+		{"celsius negative", NewCelsius(-40), -40, -40, "-40°C"},
+		{"rounded string", Temperature{Value: 22.2222, Units: Celsius}, 72, 22.2222, "22.2°C"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.temp.Fahrenheit(); math.Abs(got-test.fahrenheit) > 0.001 {
+				t.Error("Fahrenheit invalid, got:", got, "want:", test.fahrenheit)
+			}
+			if got := test.temp.Celsius(); math.Abs(got-test.celsius) > 0.001 {
+				t.Error("Celsius invalid, got:", got, "want:", test.celsius)
+			}
+			if got := test.temp.String(); got != test.str {
+				t.Error("String invalid, got:", got, "want:", test.str)
+			}
+			if got := test.temp.In(Celsius); got.Units != Celsius || math.Abs(got.Value-test.celsius) > 0.001 {
+				t.Error("In(Celsius) invalid, got:", got, "want:", test.celsius)
+			}
+			if got := test.temp.In(Fahrenheit); got.Units != Fahrenheit || math.Abs(got.Value-test.fahrenheit) > 0.001 {
+				t.Error("In(Fahrenheit) invalid, got:", got, "want:", test.fahrenheit)
+			}
+		})
+	}
+}
+
+func TestQueryTemperatures(t *testing.T) {
+	info := &QueryInfo{TempUnits: Celsius, SpaceTemp: 21, HeatTemp: 20.5, CoolTemp: 24}
+	if got := info.SpaceTemperature().String(); got != "21°C" {
+		t.Error("SpaceTemperature invalid, got:", got, "want: 21°C")
+	}
+	if got := info.HeatTemperature().String(); got != "20.5°C" {
+		t.Error("HeatTemperature invalid, got:", got, "want: 20.5°C")
+	}
+	if got := info.CoolTemperature().String(); got != "24°C" {
+		t.Error("CoolTemperature invalid, got:", got, "want: 24°C")
+	}
+	units := Fahrenheit
+	sensor := &Sensor{Name: "Outdoor", Temp: 50, Units: &units}
+	if got, ok := sensor.Temperature(); !ok || got.Celsius() != 10 {
+		t.Error("Sensor Temperature invalid, got:", got.Celsius(), ok, "want: 10 true")
+	}
+	if _, ok := (&Sensor{Name: "Outdoor", Temp: 50}).Temperature(); ok {
+		t.Error("Sensor Temperature returned without units")
+	}
+}
+
+func TestSensorUnits(t *testing.T) {
+	bodies := map[string]string{
+		"/query/info":    `{"name": "Thermostat", "tempunits": 1, "spacetemp": 21}`,
+		"/query/sensors": `{"sensors": [{"name": "Thermostat", "temp": 21}]}`,
+	}
+	tests := []struct {
+		name  string
+		fetch func(*Thermostat) ([]*Sensor, error)
+		want  string
+		infos int
+	}{
+		{"sensors", func(tstat *Thermostat) ([]*Sensor, error) {
+			return tstat.GetQuerySensors()
+		}, "unknown", 0},
+		{"snapshot", func(tstat *Thermostat) ([]*Sensor, error) {
+			snap, err := tstat.Snapshot(context.Background())
+			return snap.Sensors, err
+		}, "21°C", 1},
+		{"snapshot without query info", func(tstat *Thermostat) ([]*Sensor, error) {
+			snap, err := tstat.SnapshotSections(context.Background(), SectionSensors)
+			return snap.Sensors, err
+		}, "unknown", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &routeClient{bodies: bodies}
+			sensors, err := test.fetch(New("127.0.0.1", WithHTTPClient(client)))
+			if err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			got := "unknown"
+			if temp, ok := sensors[0].Temperature(); ok {
+				got = temp.String()
+			}
+			if got != test.want {
+				t.Error("Temperature invalid, got:", got, "want:", test.want)
+			}
+			if got := client.requested("/query/sensors"); got != 1 {
+				t.Error("sensors requests invalid, got:", got, "want: 1")
+			}
+			if got := client.requested("/query/info"); got != test.infos {
+				t.Error("query info requests invalid, got:", got, "want:", test.infos)
+			}
+		})
+	}
+}
+
+func TestControlRequestSetTemperature(t *testing.T) {
+	tests := []struct {
+		name  string
+		cr    func() *ControlRequest
+		heat  Temperature
+		cool  Temperature
+		units TempUnits
+		want  [2]float64
+	}{
+		{"celsius on fahrenheit unit", func() *ControlRequest {
+			return NewControlRequestFor(&QueryInfo{TempUnits: Fahrenheit})
+		}, NewCelsius(21.5), NewCelsius(24), Fahrenheit, [2]float64{71, 75}},
+		{"fahrenheit on celsius unit", func() *ControlRequest {
+			return NewControlRequest().SetUnits(Celsius)
+		}, NewFahrenheit(70), NewFahrenheit(76), Celsius, [2]float64{21, 24.5}},
+		{"same units", func() *ControlRequest {
+			return NewControlRequest().SetUnits(Celsius)
+		}, NewCelsius(21.5), NewCelsius(24), Celsius, [2]float64{21.5, 24}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cr := test.cr().SetHeatTemperature(test.heat).SetCoolTemperature(test.cool)
+			if *cr.HeatTemp != test.want[0] {
+				t.Error("HeatTemp invalid, got:", *cr.HeatTemp, "want:", test.want[0])
+			}
+			if *cr.CoolTemp != test.want[1] {
+				t.Error("CoolTemp invalid, got:", *cr.CoolTemp, "want:", test.want[1])
+			}
+			if *cr.units != test.units {
+				t.Error("units invalid, got:", *cr.units, "want:", test.units)
+			}
+			if err := cr.Validate(); err != nil {
+				t.Error("Error invalid, got:", err.Error(), "want: nil")
+			}
+		})
+	}
+	t.Run("unknown units rejected", func(t *testing.T) {
+		cr := NewControlRequest().SetHeatTemperature(NewCelsius(21.5)).SetCoolTemperature(NewCelsius(24))
+		if cr.HeatTemp != nil || cr.CoolTemp != nil {
+			t.Error("temperatures unexpectedly set, got:", cr.HeatTemp, cr.CoolTemp)
+		}
+		err := cr.BuildRequest(&http.Request{Header: make(http.Header)})
+		want := "HeatTemp 21.5°C can't be converted as the thermostat units are unknown; CoolTemp 24°C can't be converted as the thermostat units are unknown"
+		if !errors.Is(err, ErrValidation) || err.Error() != want {
+			t.Error("Error invalid, got:", err, "want:", want)
+		}
+	})
+}
@@ -0,0 +1,200 @@
+// Package thermostattest provides a stand-in thermostat serving the Venstar
+// Local API for use in tests.
+package thermostattest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+// DefaultBodies are the responses served for the api endpoints other than
+// the query info until replaced with SetBody.
+var DefaultBodies = map[string]string{
+	"/":               `{"api_ver": 7, "type": "residential", "model": "COLORTOUCH", "firmware": "5.10"}`,
+	"/query/sensors":  `{"sensors": [{"name": "Thermostat", "temp": 68}, {"name": "Outdoor", "temp": 32}]}`,
+	"/query/runtimes": `{"runtimes": [{"ts": 1700000000, "heat1": 30, "heat2": 5, "cool1": 0, "aux1": 0}]}`,
+	"/query/alerts":   `{"alerts": [{"name": "Air Filter", "active": true}, {"name": "Service", "active": false}]}`,
+}
+
+// Server is a stand-in thermostat. The query info is served from the info
+// the Server was created with, and control and settings updates are applied
+// to it. Other endpoints respond with DefaultBodies, see SetBody.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	info     thermostat.QueryInfo
+	bodies   map[string]string
+	requests map[string]int
+	updates  []url.Values
+
+	// lag delays applying updates until the query info has been requested
+	// lag times.
+	lag     int
+	pending *thermostat.QueryInfo
+	waiting int
+	// clamp is applied to the query info after each update.
+	clamp func(*thermostat.QueryInfo)
+}
+
+// NewServer starts a Server serving info, which is closed when the test
+// completes.
+func NewServer(tb testing.TB, info thermostat.QueryInfo) *Server {
+	tb.Helper()
+	s := &Server{
+		info:     info,
+		bodies:   make(map[string]string),
+		requests: make(map[string]int),
+	}
+	for path, body := range DefaultBodies {
+		s.bodies[path] = body
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Host returns the host and port the Server is listening on.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// Thermostat returns a Thermostat connected to the Server.
+func (s *Server) Thermostat(opts ...thermostat.Option) *thermostat.Thermostat {
+	return thermostat.New(s.Host(), opts...)
+}
+
+// SetBody sets the response for path. The query info, control and settings
+// endpoints are not affected.
+func (s *Server) SetBody(path, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bodies[path] = body
+}
+
+// Info returns the query info currently served.
+func (s *Server) Info() thermostat.QueryInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info
+}
+
+// UpdateInfo applies fn to the query info served.
+func (s *Server) UpdateInfo(fn func(*thermostat.QueryInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.info)
+}
+
+// SetLag delays applying updates until the query info has been requested n
+// more times, such as a thermostat which is slow to reflect changes.
+func (s *Server) SetLag(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lag = n
+}
+
+// SetClamp sets a func applied to the query info after each update, such as
+// a thermostat which clamps or ignores values.
+func (s *Server) SetClamp(clamp func(*thermostat.QueryInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clamp = clamp
+}
+
+// Requests returns how many times path has been requested.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Updates returns the forms of every control and settings update received.
+func (s *Server) Updates() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.updates...)
+}
+
+// LastUpdate returns the form of the last control or settings update
+// received, or nil if there have been none.
+func (s *Server) LastUpdate() url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.updates) == 0 {
+		return nil
+	}
+	return s.updates[len(s.updates)-1]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[r.URL.Path]++
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/query/info":
+		if s.pending != nil {
+			if s.waiting--; s.waiting < 0 {
+				s.info, s.pending = *s.pending, nil
+			}
+		}
+		json.NewEncoder(w).Encode(s.info)
+	case "/control", "/settings":
+		r.ParseForm()
+		s.updates = append(s.updates, r.PostForm)
+		info := s.info
+		if s.pending != nil {
+			info = *s.pending
+		}
+		applyUpdate(&info, r.PostForm)
+		if s.clamp != nil {
+			s.clamp(&info)
+		}
+		if s.lag > 0 {
+			s.pending, s.waiting = &info, s.lag
+		} else {
+			s.info = info
+		}
+		io.WriteString(w, `{"success": true}`)
+	default:
+		body, ok := s.bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, body)
+	}
+}
+
+// applyUpdate sets the query info fields provided in the update form.
+func applyUpdate(info *thermostat.QueryInfo, form url.Values) {
+	setInt := func(key string, dst *int) {
+		if v := form.Get(key); v != "" {
+			*dst, _ = strconv.Atoi(v)
+		}
+	}
+	setFloat := func(key string, dst *float64) {
+		if v := form.Get(key); v != "" {
+			*dst, _ = strconv.ParseFloat(v, 64)
+		}
+	}
+	setInt("mode", (*int)(&info.Mode))
+	setInt("fan", (*int)(&info.Fan))
+	setFloat("heattemp", &info.HeatTemp)
+	setFloat("cooltemp", &info.CoolTemp)
+	setInt("tempunits", (*int)(&info.TempUnits))
+	setInt("away", (*int)(&info.Away))
+	setInt("schedule", (*int)(&info.Schedule))
+	setInt("hum_setpoint", &info.HumidifySetPoint)
+	setInt("dehum_setpoint", &info.DehumidifySetPoint)
+}
@@ -0,0 +1,57 @@
+package thermostattest
+
+import (
+	"testing"
+
+	"go.mrm.dev/venstar/thermostat"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer(t, thermostat.QueryInfo{Name: "Hallway", HeatTemp: 68, CoolTemp: 74})
+	tstat := s.Thermostat()
+
+	t.Run("updates applied", func(t *testing.T) {
+		if err := tstat.UpdateControls(thermostat.NewControlRequest().SetHeatTemp(70)); err != nil {
+			t.Fatal("error unexpectedly returned: ", err)
+		}
+		if got := s.LastUpdate().Get("heattemp"); got != "70" {
+			t.Error("update invalid, got:", got, "want: 70")
+		}
+		info, err := tstat.GetQueryInfo()
+		if err != nil {
+			t.Fatal("error unexpectedly returned: ", err)
+		}
+		if info.HeatTemp != 70 || info.CoolTemp != 74 {
+			t.Error("info invalid, got:", info.HeatTemp, info.CoolTemp, "want: 70 74")
+		}
+	})
+	t.Run("lag and clamp", func(t *testing.T) {
+		s.SetLag(1)
+		s.SetClamp(func(info *thermostat.QueryInfo) { info.CoolTemp = min(info.CoolTemp, 76) })
+		if err := tstat.UpdateControls(thermostat.NewControlRequest().SetCoolTemp(80)); err != nil {
+			t.Fatal("error unexpectedly returned: ", err)
+		}
+		for _, want := range []float64{74, 76} {
+			info, err := tstat.GetQueryInfo()
+			if err != nil {
+				t.Fatal("error unexpectedly returned: ", err)
+			}
+			if info.CoolTemp != want {
+				t.Error("CoolTemp invalid, got:", info.CoolTemp, "want:", want)
+			}
+		}
+	})
+	t.Run("bodies", func(t *testing.T) {
+		s.SetBody("/query/alerts", `{"alerts": []}`)
+		alerts, err := tstat.GetQueryAlerts()
+		if err != nil {
+			t.Fatal("error unexpectedly returned: ", err)
+		}
+		if len(alerts) != 0 {
+			t.Error("alerts invalid, got:", len(alerts), "want: 0")
+		}
+		if got := s.Requests("/query/alerts"); got != 1 {
+			t.Error("requests invalid, got:", got, "want: 1")
+		}
+	})
+}
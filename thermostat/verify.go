@@ -0,0 +1,156 @@
+package thermostat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultVerifyPolicy is used for any VerifyPolicy fields left unset.
+var DefaultVerifyPolicy = VerifyPolicy{
+	Timeout:  10 * time.Second,
+	Interval: time.Second,
+}
+
+// VerifyPolicy configures how updates are verified, see WithVerify.
+type VerifyPolicy struct {
+	// Timeout is how long to wait for the update to be reflected.
+	Timeout time.Duration
+	// Interval is the delay between query info requests.
+	Interval time.Duration
+}
+
+func (p *VerifyPolicy) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return DefaultVerifyPolicy.Timeout
+	}
+	return p.Timeout
+}
+
+func (p *VerifyPolicy) interval() time.Duration {
+	if p.Interval <= 0 {
+		return DefaultVerifyPolicy.Interval
+	}
+	return p.Interval
+}
+
+// FieldMismatch describes an updated field the thermostat does not reflect.
+type FieldMismatch struct {
+	Field string
+	Want  float64
+	Got   float64
+}
+
+func (m FieldMismatch) String() string {
+	return fmt.Sprintf("%s got %v want %v", m.Field, m.Got, m.Want)
+}
+
+// VerifyError is returned when the thermostat accepted an update but the
+// requested values were not reflected in its query info before the verify
+// timeout expired. This happens when the thermostat clamps or ignores values.
+type VerifyError struct {
+	// Endpoint is the api path updated, such as `/control`.
+	Endpoint   string
+	Mismatches []FieldMismatch
+}
+
+func (e *VerifyError) Error() string {
+	msgs := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		msgs[i] = m.String()
+	}
+	return e.Endpoint + " update not reflected: " + strings.Join(msgs, ", ")
+}
+
+// expectedField is a requested value along with how to read it back from
+// the query info.
+type expectedField struct {
+	field string
+	want  float64
+	got   func(*QueryInfo) float64
+}
+
+func (cr *ControlRequest) expectedFields() []expectedField {
+	var fields []expectedField
+	if cr.Mode != nil {
+		fields = append(fields, expectedField{"Mode", float64(*cr.Mode), func(qi *QueryInfo) float64 { return float64(qi.Mode) }})
+	}
+	if cr.Fan != nil {
+		fields = append(fields, expectedField{"Fan", float64(*cr.Fan), func(qi *QueryInfo) float64 { return float64(qi.Fan) }})
+	}
+	if cr.HeatTemp != nil {
+		fields = append(fields, expectedField{"HeatTemp", *cr.HeatTemp, func(qi *QueryInfo) float64 { return qi.HeatTemp }})
+	}
+	if cr.CoolTemp != nil {
+		fields = append(fields, expectedField{"CoolTemp", *cr.CoolTemp, func(qi *QueryInfo) float64 { return qi.CoolTemp }})
+	}
+	return fields
+}
+
+func (sr *SettingsRequest) expectedFields() []expectedField {
+	var fields []expectedField
+	if sr.TempUnits != nil {
+		fields = append(fields, expectedField{"TempUnits", float64(*sr.TempUnits), func(qi *QueryInfo) float64 { return float64(qi.TempUnits) }})
+	}
+	if sr.IsAway != nil {
+		fields = append(fields, expectedField{"Away", float64(*sr.IsAway), func(qi *QueryInfo) float64 { return float64(qi.Away) }})
+	}
+	if sr.Schedule != nil {
+		fields = append(fields, expectedField{"Schedule", float64(*sr.Schedule), func(qi *QueryInfo) float64 { return float64(qi.Schedule) }})
+	}
+	if sr.HumidifySetPoint != nil {
+		fields = append(fields, expectedField{"HumidifySetPoint", float64(*sr.HumidifySetPoint), func(qi *QueryInfo) float64 { return float64(qi.HumidifySetPoint) }})
+	}
+	if sr.DehumidifySetPoint != nil {
+		fields = append(fields, expectedField{"DehumidifySetPoint", float64(*sr.DehumidifySetPoint), func(qi *QueryInfo) float64 { return float64(qi.DehumidifySetPoint) }})
+	}
+	return fields
+}
+
+func mismatches(fields []expectedField, info *QueryInfo) []FieldMismatch {
+	var mismatches []FieldMismatch
+	for _, f := range fields {
+		if got := f.got(info); got != f.want {
+			mismatches = append(mismatches, FieldMismatch{Field: f.field, Want: f.want, Got: got})
+		}
+	}
+	return mismatches
+}
+
+// verifyUpdate polls the query info until the expected fields are reflected,
+// returning a VerifyError if they are not before the verify timeout.
+func (t *Thermostat) verifyUpdate(ctx context.Context, endpoint string, fields []expectedField) error {
+	if t.verifyPolicy == nil || len(fields) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.verifyPolicy.timeout())
+	defer cancel()
+
+	var verifyErr *VerifyError
+	var queryErr error
+	for {
+		info, err := t.GetQueryInfoContext(ctx)
+		if err != nil {
+			// Keep the thermostat's error over one caused by the timeout.
+			if queryErr == nil || ctx.Err() == nil {
+				queryErr = err
+			}
+		} else {
+			found := mismatches(fields, info)
+			if len(found) == 0 {
+				return nil
+			}
+			verifyErr = &VerifyError{Endpoint: endpoint, Mismatches: found}
+		}
+		if err := sleepContext(ctx, t.verifyPolicy.interval()); err != nil {
+			if verifyErr != nil {
+				return verifyErr
+			}
+			if queryErr == nil {
+				queryErr = err
+			}
+			return fmt.Errorf("verifying %s update: %w", endpoint, queryErr)
+		}
+	}
+}
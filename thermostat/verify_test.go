@@ -0,0 +1,132 @@
+package thermostat_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mrm.dev/venstar/thermostat"
+	"go.mrm.dev/venstar/thermostat/thermostattest"
+)
+
+// queryErrorClient accepts updates while failing query info requests. When
+// stall is set, query info requests after the first block until their context
+// is done.
+type queryErrorClient struct {
+	stall   bool
+	queries int
+}
+
+func (c *queryErrorClient) Do(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != "/query/info" {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"success": true}`)),
+		}, nil
+	}
+	if c.queries++; c.stall && c.queries > 1 {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	return nil, errors.New("this is an error")
+}
+
+func TestVerifyUpdates(t *testing.T) {
+	policy := thermostat.VerifyPolicy{Timeout: 200 * time.Millisecond, Interval: 5 * time.Millisecond}
+	tests := []struct {
+		name   string
+		lag    int
+		clamp  func(*thermostat.QueryInfo)
+		update func(*thermostat.Thermostat) error
+		want   []thermostat.FieldMismatch
+	}{
+		{"controls reflected", 0, nil, func(tstat *thermostat.Thermostat) error {
+			return tstat.UpdateControls(thermostat.NewControlRequest().Heat(70, 75))
+		}, nil},
+		{"controls reflected after lag", 3, nil, func(tstat *thermostat.Thermostat) error {
+			return tstat.UpdateControls(thermostat.NewControlRequest().FanOn())
+		}, nil},
+		{"controls clamped", 0, func(qi *thermostat.QueryInfo) {
+			qi.HeatTemp = min(qi.HeatTemp, 72)
+			qi.Fan = 0
+		}, func(tstat *thermostat.Thermostat) error {
+			return tstat.UpdateControls(thermostat.NewControlRequest().Heat(80, 85).FanOn())
+		}, []thermostat.FieldMismatch{{"Fan", 1, 0}, {"HeatTemp", 80, 72}}},
+		{"settings reflected", 0, nil, func(tstat *thermostat.Thermostat) error {
+			return tstat.UpdateSettings(thermostat.NewSettingsRequest().Away().ScheduleOn())
+		}, nil},
+		{"settings ignored", 0, func(qi *thermostat.QueryInfo) {
+			qi.Away = 0
+		}, func(tstat *thermostat.Thermostat) error {
+			return tstat.UpdateSettings(thermostat.NewSettingsRequest().Away().ScheduleOn())
+		}, []thermostat.FieldMismatch{{"Away", 1, 0}}},
+		{"modify controls", 0, func(qi *thermostat.QueryInfo) {
+			qi.CoolTemp = 80
+		}, func(tstat *thermostat.Thermostat) error {
+			return tstat.ModifyControls(context.Background(), func(cr *thermostat.ControlRequest) { cr.SetCoolTemp(78) })
+		}, []thermostat.FieldMismatch{{"CoolTemp", 78, 80}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := thermostattest.NewServer(t, fakeQueryInfo)
+			fake.SetLag(test.lag)
+			fake.SetClamp(test.clamp)
+
+			tstat := fake.Thermostat(thermostat.WithVerify(policy))
+			err := test.update(tstat)
+			if test.want == nil {
+				if err != nil {
+					t.Fatal("error unexpectedly returned: ", err)
+				}
+				return
+			}
+			var verifyErr *thermostat.VerifyError
+			if !errors.As(err, &verifyErr) {
+				t.Fatal("error invalid, got:", err, "want: *thermostat.VerifyError")
+			}
+			if !reflect.DeepEqual(verifyErr.Mismatches, test.want) {
+				t.Error("mismatches invalid, got:", verifyErr.Mismatches, "want:", test.want)
+			}
+		})
+	}
+	t.Run("error message", func(t *testing.T) {
+		err := &thermostat.VerifyError{Endpoint: "/control", Mismatches: []thermostat.FieldMismatch{{"Fan", 1, 0}, {"HeatTemp", 80, 72}}}
+		want := "/control update not reflected: Fan got 0 want 1, HeatTemp got 72 want 80"
+		if err.Error() != want {
+			t.Error("error invalid, got:", err.Error(), "want:", want)
+		}
+	})
+	t.Run("disabled by default", func(t *testing.T) {
+		fake := thermostattest.NewServer(t, fakeQueryInfo)
+		fake.SetClamp(func(qi *thermostat.QueryInfo) { qi.Fan = 0 })
+
+		tstat := fake.Thermostat()
+		if err := tstat.UpdateControls(thermostat.NewControlRequest().FanOn()); err != nil {
+			t.Error("error unexpectedly returned: ", err)
+		}
+	})
+	t.Run("query errors get returned", func(t *testing.T) {
+		for _, stall := range []bool{false, true} {
+			client := &queryErrorClient{stall: stall}
+			tstat := thermostat.New("127.0.0.1", thermostat.WithHTTPClient(client), thermostat.WithRetryPolicy(thermostat.RetryPolicy{MaxAttempts: 1}), thermostat.WithVerify(policy))
+			err := tstat.UpdateControls(thermostat.NewControlRequest().FanOn())
+			if client.queries < 2 {
+				t.Fatal("queries invalid, got:", client.queries, "want: at least 2")
+			}
+			// A stalled query failing at the timeout must not replace the
+			// thermostat's error.
+			want := "verifying /control update: processing query info request: requesting http://127.0.0.1/query/info: this is an error"
+			if err == nil || err.Error() != want {
+				t.Error("error invalid, got:", err, "want:", want)
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				t.Error("error unexpectedly wraps context.DeadlineExceeded: ", err)
+			}
+		}
+	})
+}
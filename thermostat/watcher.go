@@ -0,0 +1,266 @@
+package thermostat
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Watcher defaults.
+const (
+	DefaultWatchInterval   = 30 * time.Second
+	DefaultWatchMaxBackoff = 5 * time.Minute
+)
+
+// EventType identifies the kind of change reported by a Watcher.
+type EventType int
+
+// Watcher event types.
+const (
+	// StateChanged is sent when an operating field changes, such as the
+	// mode, state, fan or away.
+	StateChanged EventType = iota + 1
+	// SetPointChanged is sent when a heat, cool or humidity set point
+	// changes.
+	SetPointChanged
+	// AlertRaised is sent when an alert becomes active.
+	AlertRaised
+	// AlertCleared is sent when an active alert is no longer active.
+	AlertCleared
+	// SensorReading is sent for each sensor on every successful poll.
+	SensorReading
+	// Unreachable is sent when polling the thermostat starts failing.
+	Unreachable
+	// Reachable is sent when the thermostat responds after being
+	// unreachable.
+	Reachable
+)
+
+// String returns a string representation of the value.
+func (e EventType) String() string {
+	switch e {
+	case StateChanged:
+		return "state changed"
+	case SetPointChanged:
+		return "set point changed"
+	case AlertRaised:
+		return "alert raised"
+	case AlertCleared:
+		return "alert cleared"
+	case SensorReading:
+		return "sensor reading"
+	case Unreachable:
+		return "unreachable"
+	case Reachable:
+		return "reachable"
+	}
+	return ""
+}
+
+// Event is a change observed by a Watcher.
+type Event struct {
+	Type EventType
+	// Time is when the poll which observed the event completed.
+	Time time.Time
+	// Field, Old and New describe the changed QueryInfo field for
+	// StateChanged and SetPointChanged events. Old and New hold the field's
+	// type, such as Mode or float64.
+	Field string
+	Old   interface{}
+	New   interface{}
+	// Info is the query info from the poll, unset for Unreachable events.
+	Info *QueryInfo
+	// Alert is set for AlertRaised and AlertCleared events.
+	Alert *Alert
+	// Sensor is set for SensorReading events.
+	Sensor *Sensor
+	// Err is the polling error for Unreachable events.
+	Err error
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case StateChanged, SetPointChanged:
+		return fmt.Sprintf("%s: %s %v -> %v", e.Type, e.Field, e.Old, e.New)
+	case AlertRaised, AlertCleared:
+		return fmt.Sprintf("%s: %s", e.Type, e.Alert.Name)
+	case SensorReading:
+		return fmt.Sprintf("%s: %s %v", e.Type, e.Sensor.Name, e.Sensor.Temp)
+	case Unreachable:
+		return fmt.Sprintf("%s: %v", e.Type, e.Err)
+	}
+	return e.Type.String()
+}
+
+// Watcher polls a thermostat, reporting changes as events.
+//
+// The first successful poll establishes the initial state, reporting only
+// sensor readings and active alerts. While the thermostat is unreachable,
+// the delay between polls doubles up to MaxBackoff. A Watcher keeps the
+// state of the last poll and must not be run concurrently.
+type Watcher struct {
+	Thermostat *Thermostat
+	// Interval is the delay between polls. Defaults to DefaultWatchInterval.
+	Interval time.Duration
+	// Jitter randomizes each delay by up to the provided fraction (0-1) of
+	// the delay, spreading out polls of multiple thermostats.
+	Jitter float64
+	// MaxBackoff caps the delay between polls while the thermostat is
+	// unreachable. Defaults to DefaultWatchMaxBackoff.
+	MaxBackoff time.Duration
+
+	info     *QueryInfo
+	alerts   []*Alert
+	failures int
+}
+
+// NewWatcher creates a Watcher for the thermostat using the default interval.
+func NewWatcher(t *Thermostat) *Watcher {
+	return &Watcher{Thermostat: t}
+}
+
+// Watch runs the watcher in a new goroutine, delivering events over the
+// returned channel. The channel is closed once ctx is done.
+func (w *Watcher) Watch(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		w.Run(ctx, func(e Event) {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return events
+}
+
+// Run polls the thermostat until ctx is done, calling fn with each event.
+// Run returns the context's error.
+func (w *Watcher) Run(ctx context.Context, fn func(Event)) error {
+	for {
+		for _, e := range w.poll(ctx) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fn(e)
+		}
+		if err := sleepContext(ctx, w.delay()); err != nil {
+			return err
+		}
+	}
+}
+
+// delay returns the time to wait before the next poll.
+func (w *Watcher) delay() time.Duration {
+	policy := RetryPolicy{
+		InitialBackoff: w.Interval,
+		MaxBackoff:     w.MaxBackoff,
+		Jitter:         w.Jitter,
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultWatchInterval
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = max(DefaultWatchMaxBackoff, policy.InitialBackoff)
+	}
+	return policy.backoff(w.failures + 1)
+}
+
+// poll requests the current state, returning the events since the last poll.
+func (w *Watcher) poll(ctx context.Context) []Event {
+	info, sensors, alerts, err := w.fetch(ctx)
+	now := time.Now()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		w.failures++
+		if w.failures > 1 {
+			return nil
+		}
+		return []Event{{Type: Unreachable, Time: now, Err: err}}
+	}
+
+	var events []Event
+	if w.failures > 0 {
+		events = append(events, Event{Type: Reachable, Time: now, Info: info})
+	}
+	w.failures = 0
+
+	if w.info != nil {
+		events = append(events, infoChanges(w.info, info, now)...)
+	}
+	w.info = info
+
+	var active []*Alert
+	for _, alert := range alerts {
+		if alert.Active {
+			active = append(active, alert)
+			if findAlert(w.alerts, alert.Name) == nil {
+				events = append(events, Event{Type: AlertRaised, Time: now, Info: info, Alert: alert})
+			}
+		}
+	}
+	for _, alert := range w.alerts {
+		if findAlert(active, alert.Name) == nil {
+			cleared := *alert
+			cleared.Active = false
+			events = append(events, Event{Type: AlertCleared, Time: now, Info: info, Alert: &cleared})
+		}
+	}
+	w.alerts = active
+
+	for _, sensor := range sensors {
+		events = append(events, Event{Type: SensorReading, Time: now, Info: info, Sensor: sensor})
+	}
+	return events
+}
+
+func (w *Watcher) fetch(ctx context.Context) (*QueryInfo, []*Sensor, []*Alert, error) {
+	snap, err := w.Thermostat.SnapshotSections(ctx, SectionQueryInfo, SectionSensors, SectionAlerts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return snap.QueryInfo, snap.Sensors, snap.Alerts, nil
+}
+
+// setPointFields are the QueryInfo fields reported as SetPointChanged.
+var setPointFields = map[string]bool{
+	"HeatTemp":           true,
+	"CoolTemp":           true,
+	"HumidifySetPoint":   true,
+	"DehumidifySetPoint": true,
+}
+
+// stateFields are the QueryInfo fields reported as StateChanged.
+var stateFields = map[string]bool{
+	"Mode":            true,
+	"State":           true,
+	"Fan":             true,
+	"FanState":        true,
+	"TempUnits":       true,
+	"Schedule":        true,
+	"SchedulePart":    true,
+	"Away":            true,
+	"Holiday":         true,
+	"Override":        true,
+	"ForceUnoccupied": true,
+}
+
+// infoChanges returns the StateChanged and SetPointChanged events between the
+// two query infos.
+func infoChanges(prev, cur *QueryInfo, now time.Time) []Event {
+	var events []Event
+	for _, change := range Diff(prev, cur) {
+		typ := StateChanged
+		switch {
+		case setPointFields[change.Field]:
+			typ = SetPointChanged
+		case !stateFields[change.Field]:
+			continue
+		}
+		events = append(events, Event{Type: typ, Time: now, Field: change.Field, Old: change.Old, New: change.New, Info: cur})
+	}
+	return events
+}
@@ -0,0 +1,192 @@
+package thermostat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// watchClient responds with the bodies set for each path, failing every
+// request while fail is set.
+type watchClient struct {
+	mu     sync.Mutex
+	bodies map[string]string
+	fail   bool
+}
+
+func (c *watchClient) set(path, body string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bodies[path] = body
+}
+
+func (c *watchClient) setFail(fail bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fail = fail
+}
+
+func (c *watchClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail {
+		return nil, errors.New("this is an error")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(c.bodies[req.URL.Path])),
+	}, nil
+}
+
+func newWatchClient() *watchClient {
+	return &watchClient{bodies: map[string]string{
+		"/query/info":    `{"mode": 1, "state": 0, "heattemp": 68, "cooltemp": 74}`,
+		"/query/sensors": `{"sensors": [{"name": "Thermostat", "temp": 70}]}`,
+		"/query/alerts":  `{"alerts": [{"name": "Air Filter", "active": true}, {"name": "Service", "active": false}]}`,
+	}}
+}
+
+func eventStrings(events []Event) []string {
+	strs := make([]string, len(events))
+	for i, e := range events {
+		strs[i] = e.String()
+	}
+	return strs
+}
+
+func TestWatcherPoll(t *testing.T) {
+	client := newWatchClient()
+	tstat := New("127.0.0.1", WithHTTPClient(client), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	w := NewWatcher(tstat)
+	ctx := context.Background()
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"initial state", func() {}, []string{
+			"alert raised: Air Filter",
+			"sensor reading: Thermostat 70",
+		}},
+		{"changes", func() {
+			client.set("/query/info", `{"mode": 3, "state": 1, "heattemp": 70, "cooltemp": 74}`)
+			client.set("/query/sensors", `{"sensors": [{"name": "Thermostat", "temp": 71}]}`)
+			client.set("/query/alerts", `{"alerts": [{"name": "Air Filter", "active": false}, {"name": "Service", "active": true}]}`)
+		}, []string{
+			"state changed: Mode heat -> auto",
+			"state changed: State idle -> heating",
+			"set point changed: HeatTemp 68 -> 70",
+			"alert raised: Service",
+			"alert cleared: Air Filter",
+			"sensor reading: Thermostat 71",
+		}},
+		{"unreachable", func() { client.setFail(true) }, []string{
+			"unreachable: query info: processing query info request: requesting http://127.0.0.1/query/info: this is an error\n" +
+				"query sensors: processing query sensors request: requesting http://127.0.0.1/query/sensors: this is an error\n" +
+				"query alerts: processing query alerts request: requesting http://127.0.0.1/query/alerts: this is an error",
+		}},
+		{"still unreachable", func() {}, nil},
+		{"reachable", func() { client.setFail(false) }, []string{
+			"reachable",
+			"sensor reading: Thermostat 71",
+		}},
+	}
+	for _, step := range steps {
+		step.change()
+		got := eventStrings(w.poll(ctx))
+		if strings.Join(got, "\n") != strings.Join(step.want, "\n") {
+			t.Errorf("%s events invalid, got: %q want: %q", step.name, got, step.want)
+		}
+	}
+}
+
+func TestWatcherDelay(t *testing.T) {
+	w := &Watcher{Interval: time.Second, MaxBackoff: 5 * time.Second}
+	for failures, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		w.failures = failures
+		if got := w.delay(); got != want {
+			t.Error("delay after", failures, "failures invalid, got:", got, "want:", want)
+		}
+	}
+
+	w = &Watcher{}
+	if got := w.delay(); got != DefaultWatchInterval {
+		t.Error("default delay invalid, got:", got, "want:", DefaultWatchInterval)
+	}
+
+	w = &Watcher{Interval: time.Second, Jitter: 0.5}
+	for i := 0; i < 10; i++ {
+		if got := w.delay(); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Error("jittered delay out of range, got:", got)
+		}
+	}
+}
+
+func TestWatcherWatch(t *testing.T) {
+	client := newWatchClient()
+	tstat := New("127.0.0.1", WithHTTPClient(client))
+	w := &Watcher{Thermostat: tstat, Interval: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := w.Watch(ctx)
+
+	waitFor := func(typ EventType) Event {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case e := <-events:
+				if e.Type == typ {
+					return e
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for", typ)
+			}
+		}
+	}
+	waitFor(SensorReading)
+	client.set("/query/info", `{"mode": 1, "state": 0, "heattemp": 68, "cooltemp": 76}`)
+	if e := waitFor(SetPointChanged); e.Field != "CoolTemp" || e.New != 76.0 {
+		t.Errorf("event invalid, got: %+v", e)
+	}
+
+	cancel()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("events channel not closed after cancel")
+		}
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	client := newWatchClient()
+	tstat := New("127.0.0.1", WithHTTPClient(client))
+	w := &Watcher{Thermostat: tstat, Interval: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var count int
+	err := w.Run(ctx, func(e Event) {
+		if count++; count == 5 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Error("error invalid, got:", err, "want:", context.Canceled)
+	}
+	if count != 5 {
+		t.Error("events invalid, got:", count, "want:", 5)
+	}
+}